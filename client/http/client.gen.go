@@ -89,10 +89,67 @@ func WithRequestEditorFn(fn RequestEditorFn) ClientOption {
 
 // The interface specification for the client above.
 type ClientInterface interface {
+	// GetAuditEntries request
+	GetAuditEntries(ctx context.Context, params *GetAuditEntriesParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// SubmitMessageWithBody request with any body
+	SubmitMessageWithBody(ctx context.Context, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	SubmitMessage(ctx context.Context, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, body SubmitMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
 	// SubmitUpdateRecordWithBody request with any body
 	SubmitUpdateRecordWithBody(ctx context.Context, params *SubmitUpdateRecordParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
 
 	SubmitUpdateRecord(ctx context.Context, params *SubmitUpdateRecordParams, body SubmitUpdateRecordJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// AmendMessageWithBody request with any body
+	AmendMessageWithBody(ctx context.Context, messageId MessageId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	AmendMessage(ctx context.Context, messageId MessageId, body AmendMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// RetractMessageWithBody request with any body
+	RetractMessageWithBody(ctx context.Context, messageId MessageId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	RetractMessage(ctx context.Context, messageId MessageId, body RetractMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetMessageStatus request
+	GetMessageStatus(ctx context.Context, messageId MessageId, reqEditors ...RequestEditorFn) (*http.Response, error)
+}
+
+func (c *Client) GetAuditEntries(ctx context.Context, params *GetAuditEntriesParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetAuditEntriesRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) SubmitMessageWithBody(ctx context.Context, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewSubmitMessageRequestWithBody(c.Server, messageType, params, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) SubmitMessage(ctx context.Context, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, body SubmitMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewSubmitMessageRequest(c.Server, messageType, params, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
 }
 
 func (c *Client) SubmitUpdateRecordWithBody(ctx context.Context, params *SubmitUpdateRecordParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
@@ -119,27 +176,255 @@ func (c *Client) SubmitUpdateRecord(ctx context.Context, params *SubmitUpdateRec
 	return c.Client.Do(req)
 }
 
-// NewSubmitUpdateRecordRequest calls the generic SubmitUpdateRecord builder with application/json body
-func NewSubmitUpdateRecordRequest(server string, params *SubmitUpdateRecordParams, body SubmitUpdateRecordJSONRequestBody) (*http.Request, error) {
+func (c *Client) AmendMessageWithBody(ctx context.Context, messageId MessageId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewAmendMessageRequestWithBody(c.Server, messageId, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) AmendMessage(ctx context.Context, messageId MessageId, body AmendMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewAmendMessageRequest(c.Server, messageId, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) RetractMessageWithBody(ctx context.Context, messageId MessageId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewRetractMessageRequestWithBody(c.Server, messageId, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) RetractMessage(ctx context.Context, messageId MessageId, body RetractMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewRetractMessageRequest(c.Server, messageId, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetMessageStatus(ctx context.Context, messageId MessageId, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetMessageStatusRequest(c.Server, messageId)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+// NewGetAuditEntriesRequest generates requests for GetAuditEntries
+func NewGetAuditEntriesRequest(server string, params *GetAuditEntriesParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/v1/audit/entries")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		queryValues := queryURL.Query()
+
+		if params.MessageId != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "messageId", runtime.ParamLocationQuery, *params.MessageId); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.ClientId != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "clientId", runtime.ParamLocationQuery, *params.ClientId); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.CorrelationId != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "correlationId", runtime.ParamLocationQuery, *params.CorrelationId); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.NhsNumber != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "nhsNumber", runtime.ParamLocationQuery, *params.NhsNumber); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.Event != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "event", runtime.ParamLocationQuery, *params.Event); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.From != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "from", runtime.ParamLocationQuery, *params.From); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.To != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "to", runtime.ParamLocationQuery, *params.To); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.Limit != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "limit", runtime.ParamLocationQuery, *params.Limit); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		queryURL.RawQuery = queryValues.Encode()
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewSubmitMessageRequest calls the generic SubmitMessage builder with application/json body
+func NewSubmitMessageRequest(server string, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, body SubmitMessageJSONRequestBody) (*http.Request, error) {
 	var bodyReader io.Reader
 	buf, err := json.Marshal(body)
 	if err != nil {
 		return nil, err
 	}
 	bodyReader = bytes.NewReader(buf)
-	return NewSubmitUpdateRecordRequestWithBody(server, params, "application/json", bodyReader)
+	return NewSubmitMessageRequestWithBody(server, messageType, params, "application/json", bodyReader)
 }
 
-// NewSubmitUpdateRecordRequestWithBody generates requests for SubmitUpdateRecord with any type of body
-func NewSubmitUpdateRecordRequestWithBody(server string, params *SubmitUpdateRecordParams, contentType string, body io.Reader) (*http.Request, error) {
+// NewSubmitMessageRequestWithBody generates requests for SubmitMessage with any type of body
+func NewSubmitMessageRequestWithBody(server string, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, contentType string, body io.Reader) (*http.Request, error) {
 	var err error
 
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "messageType", runtime.ParamLocationPath, messageType)
+	if err != nil {
+		return nil, err
+	}
+
 	serverURL, err := url.Parse(server)
 	if err != nil {
 		return nil, err
 	}
 
-	operationPath := fmt.Sprintf("/v1/update-record/messages")
+	operationPath := fmt.Sprintf("/v1/messages/%s", pathParam0)
 	if operationPath[0] == '/' {
 		operationPath = "." + operationPath
 	}
@@ -185,98 +470,649 @@ func NewSubmitUpdateRecordRequestWithBody(server string, params *SubmitUpdateRec
 	return req, nil
 }
 
-func (c *Client) applyEditors(ctx context.Context, req *http.Request, additionalEditors []RequestEditorFn) error {
-	for _, r := range c.RequestEditors {
-		if err := r(ctx, req); err != nil {
-			return err
-		}
-	}
-	for _, r := range additionalEditors {
-		if err := r(ctx, req); err != nil {
-			return err
-		}
+// NewSubmitUpdateRecordRequest calls the generic SubmitUpdateRecord builder with application/json body
+func NewSubmitUpdateRecordRequest(server string, params *SubmitUpdateRecordParams, body SubmitUpdateRecordJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	bodyReader = bytes.NewReader(buf)
+	return NewSubmitUpdateRecordRequestWithBody(server, params, "application/json", bodyReader)
 }
 
-// ClientWithResponses builds on ClientInterface to offer response payloads
-type ClientWithResponses struct {
-	ClientInterface
-}
+// NewSubmitUpdateRecordRequestWithBody generates requests for SubmitUpdateRecord with any type of body
+func NewSubmitUpdateRecordRequestWithBody(server string, params *SubmitUpdateRecordParams, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
 
-// NewClientWithResponses creates a new ClientWithResponses, which wraps
-// Client with return type handling
-func NewClientWithResponses(server string, opts ...ClientOption) (*ClientWithResponses, error) {
-	client, err := NewClient(server, opts...)
+	serverURL, err := url.Parse(server)
 	if err != nil {
 		return nil, err
 	}
-	return &ClientWithResponses{client}, nil
-}
 
-// WithBaseURL overrides the baseURL.
-func WithBaseURL(baseURL string) ClientOption {
-	return func(c *Client) error {
-		newBaseURL, err := url.Parse(baseURL)
-		if err != nil {
-			return err
-		}
-		c.Server = newBaseURL.String()
-		return nil
+	operationPath := fmt.Sprintf("/v1/update-record/messages")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
 	}
-}
 
-// ClientWithResponsesInterface is the interface specification for the client with responses above.
-type ClientWithResponsesInterface interface {
-	// SubmitUpdateRecordWithBodyWithResponse request with any body
-	SubmitUpdateRecordWithBodyWithResponse(ctx context.Context, params *SubmitUpdateRecordParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SubmitUpdateRecordResponse, error)
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
 
-	SubmitUpdateRecordWithResponse(ctx context.Context, params *SubmitUpdateRecordParams, body SubmitUpdateRecordJSONRequestBody, reqEditors ...RequestEditorFn) (*SubmitUpdateRecordResponse, error)
-}
+	req, err := http.NewRequest("POST", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
 
-type SubmitUpdateRecordResponse struct {
-	Body         []byte
-	HTTPResponse *http.Response
-	JSON202      *SubmitAccepted
-	JSON400      *ErrorResponse
-	JSON409      *ErrorResponse
-	JSON422      *ErrorResponse
-	JSON502      *ErrorResponse
-	JSON503      *ErrorResponse
-	JSON504      *ErrorResponse
-}
+	req.Header.Add("Content-Type", contentType)
 
-// Status returns HTTPResponse.Status
-func (r SubmitUpdateRecordResponse) Status() string {
+	if params != nil {
+
+		if params.IdempotencyKey != nil {
+			var headerParam0 string
+
+			headerParam0, err = runtime.StyleParamWithLocation("simple", false, "Idempotency-Key", runtime.ParamLocationHeader, *params.IdempotencyKey)
+			if err != nil {
+				return nil, err
+			}
+
+			req.Header.Set("Idempotency-Key", headerParam0)
+		}
+
+		if params.XCorrelationID != nil {
+			var headerParam1 string
+
+			headerParam1, err = runtime.StyleParamWithLocation("simple", false, "X-Correlation-ID", runtime.ParamLocationHeader, *params.XCorrelationID)
+			if err != nil {
+				return nil, err
+			}
+
+			req.Header.Set("X-Correlation-ID", headerParam1)
+		}
+
+	}
+
+	return req, nil
+}
+
+// NewAmendMessageRequest calls the generic AmendMessage builder with application/json body
+func NewAmendMessageRequest(server string, messageId MessageId, body AmendMessageJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewAmendMessageRequestWithBody(server, messageId, "application/json", bodyReader)
+}
+
+// NewAmendMessageRequestWithBody generates requests for AmendMessage with any type of body
+func NewAmendMessageRequestWithBody(server string, messageId MessageId, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "messageId", runtime.ParamLocationPath, messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/v1/update-record/messages/%s/amend", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
+// NewRetractMessageRequest calls the generic RetractMessage builder with application/json body
+func NewRetractMessageRequest(server string, messageId MessageId, body RetractMessageJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewRetractMessageRequestWithBody(server, messageId, "application/json", bodyReader)
+}
+
+// NewRetractMessageRequestWithBody generates requests for RetractMessage with any type of body
+func NewRetractMessageRequestWithBody(server string, messageId MessageId, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "messageId", runtime.ParamLocationPath, messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/v1/update-record/messages/%s/retract", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
+// NewGetMessageStatusRequest generates requests for GetMessageStatus
+func NewGetMessageStatusRequest(server string, messageId MessageId) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "messageId", runtime.ParamLocationPath, messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/v1/update-record/messages/%s/status", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func (c *Client) applyEditors(ctx context.Context, req *http.Request, additionalEditors []RequestEditorFn) error {
+	for _, r := range c.RequestEditors {
+		if err := r(ctx, req); err != nil {
+			return err
+		}
+	}
+	for _, r := range additionalEditors {
+		if err := r(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClientWithResponses builds on ClientInterface to offer response payloads
+type ClientWithResponses struct {
+	ClientInterface
+}
+
+// NewClientWithResponses creates a new ClientWithResponses, which wraps
+// Client with return type handling
+func NewClientWithResponses(server string, opts ...ClientOption) (*ClientWithResponses, error) {
+	client, err := NewClient(server, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientWithResponses{client}, nil
+}
+
+// WithBaseURL overrides the baseURL.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) error {
+		newBaseURL, err := url.Parse(baseURL)
+		if err != nil {
+			return err
+		}
+		c.Server = newBaseURL.String()
+		return nil
+	}
+}
+
+// ClientWithResponsesInterface is the interface specification for the client with responses above.
+type ClientWithResponsesInterface interface {
+	// GetAuditEntriesWithResponse request
+	GetAuditEntriesWithResponse(ctx context.Context, params *GetAuditEntriesParams, reqEditors ...RequestEditorFn) (*GetAuditEntriesResponse, error)
+
+	// SubmitMessageWithBodyWithResponse request with any body
+	SubmitMessageWithBodyWithResponse(ctx context.Context, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SubmitMessageResponse, error)
+
+	SubmitMessageWithResponse(ctx context.Context, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, body SubmitMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*SubmitMessageResponse, error)
+
+	// SubmitUpdateRecordWithBodyWithResponse request with any body
+	SubmitUpdateRecordWithBodyWithResponse(ctx context.Context, params *SubmitUpdateRecordParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SubmitUpdateRecordResponse, error)
+
+	SubmitUpdateRecordWithResponse(ctx context.Context, params *SubmitUpdateRecordParams, body SubmitUpdateRecordJSONRequestBody, reqEditors ...RequestEditorFn) (*SubmitUpdateRecordResponse, error)
+
+	// AmendMessageWithBodyWithResponse request with any body
+	AmendMessageWithBodyWithResponse(ctx context.Context, messageId MessageId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*AmendMessageResponse, error)
+
+	AmendMessageWithResponse(ctx context.Context, messageId MessageId, body AmendMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*AmendMessageResponse, error)
+
+	// RetractMessageWithBodyWithResponse request with any body
+	RetractMessageWithBodyWithResponse(ctx context.Context, messageId MessageId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*RetractMessageResponse, error)
+
+	RetractMessageWithResponse(ctx context.Context, messageId MessageId, body RetractMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*RetractMessageResponse, error)
+
+	// GetMessageStatusWithResponse request
+	GetMessageStatusWithResponse(ctx context.Context, messageId MessageId, reqEditors ...RequestEditorFn) (*GetMessageStatusResponse, error)
+}
+
+type GetAuditEntriesResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *AuditEntries
+	JSON400      *ErrorResponse
+	JSON401      *ErrorResponse
+	JSON403      *ErrorResponse
+}
+
+// Status returns HTTPResponse.Status
+func (r GetAuditEntriesResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetAuditEntriesResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type SubmitMessageResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON202      *SubmitAccepted
+	JSON400      *ErrorResponse
+	JSON401      *ErrorResponse
+	JSON403      *ErrorResponse
+	JSON404      *ErrorResponse
+	JSON409      *ErrorResponse
+	JSON422      *ErrorResponse
+	JSON502      *ErrorResponse
+	JSON503      *ErrorResponse
+	JSON504      *ErrorResponse
+}
+
+// Status returns HTTPResponse.Status
+func (r SubmitMessageResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r SubmitMessageResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type SubmitUpdateRecordResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON202      *SubmitAccepted
+	JSON400      *ErrorResponse
+	JSON401      *ErrorResponse
+	JSON403      *ErrorResponse
+	JSON409      *ErrorResponse
+	JSON422      *ErrorResponse
+	JSON502      *ErrorResponse
+	JSON503      *ErrorResponse
+	JSON504      *ErrorResponse
+}
+
+// Status returns HTTPResponse.Status
+func (r SubmitUpdateRecordResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r SubmitUpdateRecordResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type AmendMessageResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON400      *ErrorResponse
+	JSON404      *ErrorResponse
+	JSON409      *ErrorResponse
+	JSON422      *ErrorResponse
+}
+
+// Status returns HTTPResponse.Status
+func (r AmendMessageResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r AmendMessageResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type RetractMessageResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON400      *ErrorResponse
+	JSON404      *ErrorResponse
+	JSON409      *ErrorResponse
+}
+
+// Status returns HTTPResponse.Status
+func (r RetractMessageResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r RetractMessageResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetMessageStatusResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *MessageStatus
+	JSON401      *ErrorResponse
+	JSON404      *ErrorResponse
+}
+
+// Status returns HTTPResponse.Status
+func (r GetMessageStatusResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
-	return http.StatusText(0)
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetMessageStatusResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+// GetAuditEntriesWithResponse request returning *GetAuditEntriesResponse
+func (c *ClientWithResponses) GetAuditEntriesWithResponse(ctx context.Context, params *GetAuditEntriesParams, reqEditors ...RequestEditorFn) (*GetAuditEntriesResponse, error) {
+	rsp, err := c.GetAuditEntries(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetAuditEntriesResponse(rsp)
+}
+
+// SubmitMessageWithBodyWithResponse request with arbitrary body returning *SubmitMessageResponse
+func (c *ClientWithResponses) SubmitMessageWithBodyWithResponse(ctx context.Context, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SubmitMessageResponse, error) {
+	rsp, err := c.SubmitMessageWithBody(ctx, messageType, params, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSubmitMessageResponse(rsp)
+}
+
+func (c *ClientWithResponses) SubmitMessageWithResponse(ctx context.Context, messageType SubmitMessageParamsMessageType, params *SubmitMessageParams, body SubmitMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*SubmitMessageResponse, error) {
+	rsp, err := c.SubmitMessage(ctx, messageType, params, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSubmitMessageResponse(rsp)
+}
+
+// SubmitUpdateRecordWithBodyWithResponse request with arbitrary body returning *SubmitUpdateRecordResponse
+func (c *ClientWithResponses) SubmitUpdateRecordWithBodyWithResponse(ctx context.Context, params *SubmitUpdateRecordParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SubmitUpdateRecordResponse, error) {
+	rsp, err := c.SubmitUpdateRecordWithBody(ctx, params, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSubmitUpdateRecordResponse(rsp)
+}
+
+func (c *ClientWithResponses) SubmitUpdateRecordWithResponse(ctx context.Context, params *SubmitUpdateRecordParams, body SubmitUpdateRecordJSONRequestBody, reqEditors ...RequestEditorFn) (*SubmitUpdateRecordResponse, error) {
+	rsp, err := c.SubmitUpdateRecord(ctx, params, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSubmitUpdateRecordResponse(rsp)
+}
+
+// AmendMessageWithBodyWithResponse request with arbitrary body returning *AmendMessageResponse
+func (c *ClientWithResponses) AmendMessageWithBodyWithResponse(ctx context.Context, messageId MessageId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*AmendMessageResponse, error) {
+	rsp, err := c.AmendMessageWithBody(ctx, messageId, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAmendMessageResponse(rsp)
 }
 
-// StatusCode returns HTTPResponse.StatusCode
-func (r SubmitUpdateRecordResponse) StatusCode() int {
-	if r.HTTPResponse != nil {
-		return r.HTTPResponse.StatusCode
+func (c *ClientWithResponses) AmendMessageWithResponse(ctx context.Context, messageId MessageId, body AmendMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*AmendMessageResponse, error) {
+	rsp, err := c.AmendMessage(ctx, messageId, body, reqEditors...)
+	if err != nil {
+		return nil, err
 	}
-	return 0
+	return ParseAmendMessageResponse(rsp)
 }
 
-// SubmitUpdateRecordWithBodyWithResponse request with arbitrary body returning *SubmitUpdateRecordResponse
-func (c *ClientWithResponses) SubmitUpdateRecordWithBodyWithResponse(ctx context.Context, params *SubmitUpdateRecordParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*SubmitUpdateRecordResponse, error) {
-	rsp, err := c.SubmitUpdateRecordWithBody(ctx, params, contentType, body, reqEditors...)
+// RetractMessageWithBodyWithResponse request with arbitrary body returning *RetractMessageResponse
+func (c *ClientWithResponses) RetractMessageWithBodyWithResponse(ctx context.Context, messageId MessageId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*RetractMessageResponse, error) {
+	rsp, err := c.RetractMessageWithBody(ctx, messageId, contentType, body, reqEditors...)
 	if err != nil {
 		return nil, err
 	}
-	return ParseSubmitUpdateRecordResponse(rsp)
+	return ParseRetractMessageResponse(rsp)
 }
 
-func (c *ClientWithResponses) SubmitUpdateRecordWithResponse(ctx context.Context, params *SubmitUpdateRecordParams, body SubmitUpdateRecordJSONRequestBody, reqEditors ...RequestEditorFn) (*SubmitUpdateRecordResponse, error) {
-	rsp, err := c.SubmitUpdateRecord(ctx, params, body, reqEditors...)
+func (c *ClientWithResponses) RetractMessageWithResponse(ctx context.Context, messageId MessageId, body RetractMessageJSONRequestBody, reqEditors ...RequestEditorFn) (*RetractMessageResponse, error) {
+	rsp, err := c.RetractMessage(ctx, messageId, body, reqEditors...)
 	if err != nil {
 		return nil, err
 	}
-	return ParseSubmitUpdateRecordResponse(rsp)
+	return ParseRetractMessageResponse(rsp)
+}
+
+// GetMessageStatusWithResponse request returning *GetMessageStatusResponse
+func (c *ClientWithResponses) GetMessageStatusWithResponse(ctx context.Context, messageId MessageId, reqEditors ...RequestEditorFn) (*GetMessageStatusResponse, error) {
+	rsp, err := c.GetMessageStatus(ctx, messageId, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetMessageStatusResponse(rsp)
+}
+
+// ParseGetAuditEntriesResponse parses an HTTP response from a GetAuditEntriesWithResponse call
+func ParseGetAuditEntriesResponse(rsp *http.Response) (*GetAuditEntriesResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetAuditEntriesResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest AuditEntries
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 401:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON401 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 403:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON403 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseSubmitMessageResponse parses an HTTP response from a SubmitMessageWithResponse call
+func ParseSubmitMessageResponse(rsp *http.Response) (*SubmitMessageResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SubmitMessageResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 202:
+		var dest SubmitAccepted
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON202 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 401:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON401 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 403:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON403 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 409:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON409 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 422:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON422 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 502:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON502 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 503:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON503 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 504:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON504 = &dest
+
+	}
+
+	return response, nil
 }
 
 // ParseSubmitUpdateRecordResponse parses an HTTP response from a SubmitUpdateRecordWithResponse call
@@ -307,6 +1143,20 @@ func ParseSubmitUpdateRecordResponse(rsp *http.Response) (*SubmitUpdateRecordRes
 		}
 		response.JSON400 = &dest
 
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 401:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON401 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 403:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON403 = &dest
+
 	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 409:
 		var dest ErrorResponse
 		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
@@ -346,3 +1196,130 @@ func ParseSubmitUpdateRecordResponse(rsp *http.Response) (*SubmitUpdateRecordRes
 
 	return response, nil
 }
+
+// ParseAmendMessageResponse parses an HTTP response from a AmendMessageWithResponse call
+func ParseAmendMessageResponse(rsp *http.Response) (*AmendMessageResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &AmendMessageResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 409:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON409 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 422:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON422 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseRetractMessageResponse parses an HTTP response from a RetractMessageWithResponse call
+func ParseRetractMessageResponse(rsp *http.Response) (*RetractMessageResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &RetractMessageResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 409:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON409 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetMessageStatusResponse parses an HTTP response from a GetMessageStatusWithResponse call
+func ParseGetMessageStatusResponse(rsp *http.Response) (*GetMessageStatusResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetMessageStatusResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest MessageStatus
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 401:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON401 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 404:
+		var dest ErrorResponse
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON404 = &dest
+
+	}
+
+	return response, nil
+}
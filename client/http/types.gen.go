@@ -4,6 +4,7 @@
 package http
 
 import (
+	"encoding/json"
 	"time"
 
 	openapi_types "github.com/oapi-codegen/runtime/types"
@@ -28,14 +29,27 @@ const (
 
 // Defines values for ErrorResponseErrorCode.
 const (
+	CORRECTIONMISMATCH   ErrorResponseErrorCode = "CORRECTION_MISMATCH"
+	DUPLICATESUBMISSION  ErrorResponseErrorCode = "DUPLICATE_SUBMISSION"
 	FHIRVALIDATIONFAILED ErrorResponseErrorCode = "FHIR_VALIDATION_FAILED"
+	FORBIDDEN            ErrorResponseErrorCode = "FORBIDDEN"
 	IDEMPOTENCYCONFLICT  ErrorResponseErrorCode = "IDEMPOTENCY_CONFLICT"
 	MESHUPSTREAMERROR    ErrorResponseErrorCode = "MESH_UPSTREAM_ERROR"
+	MESSAGENOTFOUND      ErrorResponseErrorCode = "MESSAGE_NOT_FOUND"
+	MESSAGESUPERSEDED    ErrorResponseErrorCode = "MESSAGE_SUPERSEDED"
 	SENDTIMEOUT          ErrorResponseErrorCode = "SEND_TIMEOUT"
 	SERVICEUNAVAILABLE   ErrorResponseErrorCode = "SERVICE_UNAVAILABLE"
+	UNAUTHORIZED         ErrorResponseErrorCode = "UNAUTHORIZED"
+	UNKNOWNMESSAGETYPE   ErrorResponseErrorCode = "UNKNOWN_MESSAGE_TYPE"
 	VALIDATIONERROR      ErrorResponseErrorCode = "VALIDATION_ERROR"
 )
 
+// Defines values for ImmunizationInputStatus.
+const (
+	ImmunizationInputStatusCompleted      ImmunizationInputStatus = "completed"
+	ImmunizationInputStatusEnteredInError ImmunizationInputStatus = "entered-in-error"
+)
+
 // Defines values for MedicationSuppliedStatus.
 const (
 	MedicationSuppliedStatusCompleted      MedicationSuppliedStatus = "completed"
@@ -48,11 +62,11 @@ const (
 	MedicationSuppliedStatusUnknown        MedicationSuppliedStatus = "unknown"
 )
 
-// Defines values for NarrativeBlockHeadingCode.
+// Defines values for MessageStatusStatus.
 const (
-	NarrativeBlockHeadingCodeClinicalSummary           NarrativeBlockHeadingCode = "clinical-summary"
-	NarrativeBlockHeadingCodeHistory                   NarrativeBlockHeadingCode = "history"
-	NarrativeBlockHeadingCodeInformationAndAdviceGiven NarrativeBlockHeadingCode = "information-and-advice-given"
+	MessageAccepted       MessageStatusStatus = "accepted"
+	MessageAmended        MessageStatusStatus = "amended"
+	MessageEnteredInError MessageStatusStatus = "entered-in-error"
 )
 
 // Defines values for ObservationInputStatus.
@@ -63,6 +77,13 @@ const (
 	Registered  ObservationInputStatus = "registered"
 )
 
+// Defines values for ParticipantRoles.
+const (
+	Authoriser ParticipantRoles = "authoriser"
+	Performer  ParticipantRoles = "performer"
+	Recorder   ParticipantRoles = "recorder"
+)
+
 // Defines values for PatientGender.
 const (
 	PatientGenderFemale  PatientGender = "female"
@@ -71,6 +92,61 @@ const (
 	PatientGenderUnknown PatientGender = "unknown"
 )
 
+// Defines values for PharmacyFirstConsultationOutcome.
+const (
+	AdviceOnly     PharmacyFirstConsultationOutcome = "advice-only"
+	OnwardReferral PharmacyFirstConsultationOutcome = "onward-referral"
+	Supply         PharmacyFirstConsultationOutcome = "supply"
+)
+
+// Defines values for PharmacyFirstConsultationPathway.
+const (
+	AcuteOtitisMedia    PharmacyFirstConsultationPathway = "acute-otitis-media"
+	Impetigo            PharmacyFirstConsultationPathway = "impetigo"
+	InfectedInsectBites PharmacyFirstConsultationPathway = "infected-insect-bites"
+	Shingles            PharmacyFirstConsultationPathway = "shingles"
+	Sinusitis           PharmacyFirstConsultationPathway = "sinusitis"
+	SoreThroat          PharmacyFirstConsultationPathway = "sore-throat"
+	UncomplicatedUti    PharmacyFirstConsultationPathway = "uncomplicated-uti"
+)
+
+// Defines values for ProcedureInputStatus.
+const (
+	Aborted        ProcedureInputStatus = "aborted"
+	Completed      ProcedureInputStatus = "completed"
+	EnteredInError ProcedureInputStatus = "entered-in-error"
+	InProgress     ProcedureInputStatus = "in-progress"
+)
+
+// Defines values for ProfessionalRegistrationType.
+const (
+	Gmc       ProfessionalRegistrationType = "gmc"
+	Gphc      ProfessionalRegistrationType = "gphc"
+	Nmc       ProfessionalRegistrationType = "nmc"
+	SdsUserId ProfessionalRegistrationType = "sds-user-id"
+)
+
+// Defines values for ReferralInputPriority.
+const (
+	Asap    ReferralInputPriority = "asap"
+	Routine ReferralInputPriority = "routine"
+	Stat    ReferralInputPriority = "stat"
+	Urgent  ReferralInputPriority = "urgent"
+)
+
+// Defines values for ServiceInputTemplate.
+const (
+	BloodPressureCheck ServiceInputTemplate = "blood-pressure-check"
+	Contraception      ServiceInputTemplate = "contraception"
+	PharmacyFirst      ServiceInputTemplate = "pharmacy-first"
+)
+
+// Defines values for ServiceValuesArm.
+const (
+	Left  ServiceValuesArm = "left"
+	Right ServiceValuesArm = "right"
+)
+
 // Defines values for SubmitAcceptedStatus.
 const (
 	Accepted SubmitAcceptedStatus = "accepted"
@@ -78,6 +154,21 @@ const (
 	Sending  SubmitAcceptedStatus = "sending"
 )
 
+// Defines values for GetAuditEntriesParamsEvent.
+const (
+	Built    GetAuditEntriesParamsEvent = "built"
+	Queried  GetAuditEntriesParamsEvent = "queried"
+	Received GetAuditEntriesParamsEvent = "received"
+	Rejected GetAuditEntriesParamsEvent = "rejected"
+	Replayed GetAuditEntriesParamsEvent = "replayed"
+	Status   GetAuditEntriesParamsEvent = "status"
+)
+
+// Defines values for SubmitMessageParamsMessageType.
+const (
+	UpdateRecord SubmitMessageParamsMessageType = "update-record"
+)
+
 // Allergy defines model for Allergy.
 type Allergy struct {
 	Code        string              `json:"code"`
@@ -98,14 +189,82 @@ type Attachment struct {
 	Title       *string `json:"title,omitempty"`
 }
 
+// AuditEntries defines model for AuditEntries.
+type AuditEntries struct {
+	Chain struct {
+		// BrokenAt Line where the chain first breaks.
+		BrokenAt *int `json:"brokenAt,omitempty"`
+
+		// Head Hash of the last entry; note it to detect entries later cut off the end.
+		Head string `json:"head"`
+
+		// Length Entries in the whole log.
+		Length   int     `json:"length"`
+		Problem  *string `json:"problem,omitempty"`
+		Verified bool    `json:"verified"`
+	} `json:"chain"`
+	Entries []AuditEntry `json:"entries"`
+
+	// Truncated More entries matched than limit.
+	Truncated bool `json:"truncated"`
+}
+
+// AuditEntry defines model for AuditEntry.
+type AuditEntry struct {
+	// Action submit, amend or retract.
+	Action        *string `json:"action,omitempty"`
+	ClientId      *string `json:"clientId,omitempty"`
+	CorrelationId *string `json:"correlationId,omitempty"`
+	Detail        *string `json:"detail,omitempty"`
+	DocumentId    *string `json:"documentId,omitempty"`
+	ErrorCode     *string `json:"errorCode,omitempty"`
+
+	// Event received, rejected, built, replayed, status or queried.
+	Event string `json:"event"`
+
+	// FhirHash SHA-256 of the built FHIR message.
+	FhirHash   *string `json:"fhirHash,omitempty"`
+	FromStatus *string `json:"fromStatus,omitempty"`
+
+	// Hash SHA-256 over prevHash and this entry with hash empty.
+	Hash          string  `json:"hash"`
+	HttpStatus    *int    `json:"httpStatus,omitempty"`
+	MeshMailbox   *string `json:"meshMailbox,omitempty"`
+	MeshMessageId *string `json:"meshMessageId,omitempty"`
+	MessageId     *string `json:"messageId,omitempty"`
+	MessageType   *string `json:"messageType,omitempty"`
+
+	// NhsNumberHash HMAC-SHA256 of the NHS number under the audit key.
+	NhsNumberHash *string `json:"nhsNumberHash,omitempty"`
+
+	// PayloadHash SHA-256 of the request body.
+	PayloadHash *string `json:"payloadHash,omitempty"`
+
+	// PrevHash Hash of the previous entry.
+	PrevHash string `json:"prevHash"`
+
+	// RelatedMessageId Message amended
+	RelatedMessageId *string   `json:"relatedMessageId,omitempty"`
+	Seq              int       `json:"seq"`
+	Time             time.Time `json:"time"`
+	ToStatus         *string   `json:"toStatus,omitempty"`
+}
+
 // Author defines model for Author.
 type Author struct {
 	Identifiers *[]Identifier `json:"identifiers,omitempty"`
-	Name        string        `json:"name"`
 
-	// ProfessionalCode Staff professional code
-	ProfessionalCode *string          `json:"professionalCode,omitempty"`
-	Role             *CodeableConcept `json:"role,omitempty"`
+	// Name Display name; split into prefix, given and family names when structuredName is absent.
+	Name string `json:"name"`
+
+	// ProfessionalCode Staff professional code. Deprecated and not recorded, as it doesn't name its register; use registrations.
+	// Deprecated: this property has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+	ProfessionalCode *string `json:"professionalCode,omitempty"`
+
+	// Registrations Professional registration and Spine identifiers, emitted with their NHS identifier systems.
+	Registrations  *[]ProfessionalRegistration `json:"registrations,omitempty"`
+	Role           *CodeableConcept            `json:"role,omitempty"`
+	StructuredName *PersonName                 `json:"structuredName,omitempty"`
 }
 
 // ClinicalSummary defines model for ClinicalSummary.
@@ -137,16 +296,36 @@ type CodedItem struct {
 
 // CompositionDetails Document-level metadata for the inner Composition.
 type CompositionDetails struct {
-	Title *string    `json:"title,omitempty"`
-	Type  *CodedItem `json:"type,omitempty"`
+	// SourceId The sending system's own ID for this record. Becomes its identifier under the provider identifier system and fixes its resource id, so a resend describes the same record.
+	SourceId *string    `json:"sourceId,omitempty"`
+	Title    *string    `json:"title,omitempty"`
+	Type     *CodedItem `json:"type,omitempty"`
+}
+
+// CorrectionRequest defines model for CorrectionRequest.
+type CorrectionRequest struct {
+	// Reason Why the record is being corrected; shown in the Composition narrative.
+	Reason *string `json:"reason,omitempty"`
+
+	// Record Full payload; minimal must-haves are required.
+	Record *UpdateRecordRequest `json:"record,omitempty"`
 }
 
 // Encounter Context of the consultation.
 type Encounter struct {
-	LocationODS         *string    `json:"locationODS,omitempty"`
+	// DurationMinutes Length of the consultation in minutes. Derived from endedAt when omitted.
+	DurationMinutes *int `json:"durationMinutes,omitempty"`
+
+	// EndedAt End of the consultation. Derived from durationMinutes when omitted.
+	EndedAt     *time.Time `json:"endedAt,omitempty"`
+	LocationODS *string    `json:"locationODS,omitempty"`
+
+	// OccurredAt Start of the consultation, with offset (e.g. 2025-06-01T09:30:00+01:00).
 	OccurredAt          *time.Time `json:"occurredAt,omitempty"`
 	OutcomeOfAttendance *CodedItem `json:"outcomeOfAttendance,omitempty"`
-	PerformerODS        *string    `json:"performerODS,omitempty"`
+
+	// PerformerODS ODS code of the sending organisation. Also picks the tenant; defaults to the tenant's defaultSenderODS.
+	PerformerODS *string `json:"performerODS,omitempty"`
 
 	// Reason Free-text reason (use reasonCode for coded value).
 	Reason     *string    `json:"reason,omitempty"`
@@ -154,27 +333,45 @@ type Encounter struct {
 
 	// ServiceType Local label for service type.
 	ServiceType *string `json:"serviceType,omitempty"`
+
+	// SourceId The sending system's own ID for this consultation. Becomes its identifier under the provider identifier system and fixes its resource id, so a resend describes the same consultation.
+	SourceId *string `json:"sourceId,omitempty"`
 }
 
 // EncounterWithRole defines model for EncounterWithRole.
 type EncounterWithRole struct {
-	LocationODS         *string    `json:"locationODS,omitempty"`
+	// DurationMinutes Length of the consultation in minutes. Derived from endedAt when omitted.
+	DurationMinutes *int `json:"durationMinutes,omitempty"`
+
+	// EndedAt End of the consultation. Derived from durationMinutes when omitted.
+	EndedAt *time.Time `json:"endedAt,omitempty"`
+
+	// Id Client-supplied encounter ID, referenced by contextEncounterRef on observations and narrative.
+	Id          *string `json:"id,omitempty"`
+	LocationODS *string `json:"locationODS,omitempty"`
+
+	// OccurredAt Start of the consultation, with offset (e.g. 2025-06-01T09:30:00+01:00).
 	OccurredAt          time.Time  `json:"occurredAt"`
 	OutcomeOfAttendance *CodedItem `json:"outcomeOfAttendance,omitempty"`
-	PerformerODS        *string    `json:"performerODS,omitempty"`
+
+	// PerformerODS ODS code of the sending organisation. Also picks the tenant; defaults to the tenant's defaultSenderODS.
+	PerformerODS *string `json:"performerODS,omitempty"`
 
 	// Reason Free-text reason (use reasonCode for coded value).
 	Reason     *string    `json:"reason,omitempty"`
 	ReasonCode *CodedItem `json:"reasonCode,omitempty"`
 
-	// Role Primary encounter becomes Composition.encounter.
+	// Role Primary encounter becomes Composition.encounter; related encounters reference it with partOf.
 	Role *EncounterWithRoleRole `json:"role,omitempty"`
 
 	// ServiceType Local label for service type.
 	ServiceType *string `json:"serviceType,omitempty"`
+
+	// SourceId The sending system's own ID for this consultation. Becomes its identifier under the provider identifier system and fixes its resource id, so a resend describes the same consultation.
+	SourceId *string `json:"sourceId,omitempty"`
 }
 
-// EncounterWithRoleRole Primary encounter becomes Composition.encounter.
+// EncounterWithRoleRole Primary encounter becomes Composition.encounter; related encounters reference it with partOf.
 type EncounterWithRoleRole string
 
 // ErrorResponse defines model for ErrorResponse.
@@ -195,6 +392,50 @@ type Identifier struct {
 	Value  string `json:"value"`
 }
 
+// ImmunizationInput A vaccination administered in pharmacy, e.g. seasonal flu or COVID-19, or one that was offered and not given.
+type ImmunizationInput struct {
+	BatchNumber *string `json:"batchNumber,omitempty"`
+
+	// ContextEncounterRef Encounter ID (encounters[].id); defaults to the primary encounter
+	ContextEncounterRef *string `json:"contextEncounterRef,omitempty"`
+
+	// Date When the vaccine was given, or the decision not to give it was made
+	Date time.Time `json:"date"`
+
+	// DoseSequence Dose number within the course
+	DoseSequence *int                `json:"doseSequence,omitempty"`
+	ExpiryDate   *openapi_types.Date `json:"expiryDate,omitempty"`
+
+	// HeadingTag Record Standard Heading the immunization is filed under. Defaults to immunisations.
+	HeadingTag *CodedItem `json:"headingTag,omitempty"`
+
+	// Id Client-supplied ID for the immunization
+	Id       *string `json:"id,omitempty"`
+	NotGiven *bool   `json:"notGiven,omitempty"`
+	Note     *string `json:"note,omitempty"`
+
+	// Performer Clinician who gave the vaccine. Defaults to provenance.author.
+	Performer *Author `json:"performer,omitempty"`
+
+	// ReasonNotGiven Why the vaccine was not given. Required when notGiven is true.
+	ReasonNotGiven *CodedItem `json:"reasonNotGiven,omitempty"`
+	Route          *CodedItem `json:"route,omitempty"`
+	Site           *CodedItem `json:"site,omitempty"`
+
+	// SourceId The sending system's own ID for this immunization. Becomes its identifier under the provider identifier system and fixes its resource id, so a resend describes the same immunization.
+	SourceId *string                  `json:"sourceId,omitempty"`
+	Status   *ImmunizationInputStatus `json:"status,omitempty"`
+
+	// TargetDisease Disease the vaccine protects against. Required with doseSequence.
+	TargetDisease *CodedItem `json:"targetDisease,omitempty"`
+
+	// VaccineProduct Vaccine product as a dm+d VMP or AMP.
+	VaccineProduct CodedItem `json:"vaccineProduct"`
+}
+
+// ImmunizationInputStatus defines model for ImmunizationInput.Status.
+type ImmunizationInputStatus string
+
 // MedicationSupplied defines model for MedicationSupplied.
 type MedicationSupplied struct {
 	Category          *CodedItem `json:"category,omitempty"`
@@ -208,20 +449,25 @@ type MedicationSupplied struct {
 		Route              *CodedItem `json:"route,omitempty"`
 		Text               *string    `json:"text,omitempty"`
 		Timing             *struct {
-			Frequency  *int     `json:"frequency,omitempty"`
-			Period     *float32 `json:"period,omitempty"`
-			PeriodUnit *string  `json:"periodUnit,omitempty"`
+			Frequency  *int         `json:"frequency,omitempty"`
+			Period     *json.Number `json:"period,omitempty"`
+			PeriodUnit *string      `json:"periodUnit,omitempty"`
 		} `json:"timing,omitempty"`
 	} `json:"dosageInstruction,omitempty"`
-	Medication     CodedItem                `json:"medication"`
-	Quantity       *Quantity                `json:"quantity,omitempty"`
+	Medication CodedItem `json:"medication"`
+	Quantity   *Quantity `json:"quantity,omitempty"`
+
+	// SourceId The sending system's own ID for this supply. Becomes its identifier under the provider identifier system and fixes its resource id, so a resend describes the same supply.
+	SourceId *string `json:"sourceId,omitempty"`
+
+	// Status declined is recorded as stopped with notDone; unknown is rejected
 	Status         MedicationSuppliedStatus `json:"status"`
 	SupplyType     *CodedItem               `json:"supplyType,omitempty"`
 	WhenHandedOver *openapi_types.Date      `json:"whenHandedOver,omitempty"`
 	WhenPrepared   *openapi_types.Date      `json:"whenPrepared,omitempty"`
 }
 
-// MedicationSuppliedStatus defines model for MedicationSupplied.Status.
+// MedicationSuppliedStatus declined is recorded as stopped with notDone; unknown is rejected
 type MedicationSuppliedStatus string
 
 // MessageHeaderOptions defines model for MessageHeaderOptions.
@@ -236,26 +482,59 @@ type MessageHeaderOptions struct {
 	SenderReference *string `json:"senderReference,omitempty"`
 }
 
+// MessageStatus defines model for MessageStatus.
+type MessageStatus struct {
+	// Amends Message this one amends.
+	Amends    *string   `json:"amends,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// DuplicateOf Earlier message with the same clinical content; set when duplicates are flagged.
+	DuplicateOf *string            `json:"duplicateOf,omitempty"`
+	Links       *map[string]string `json:"links,omitempty"`
+	MessageId   string             `json:"messageId"`
+	MessageType string             `json:"messageType"`
+	Reason      *string            `json:"reason,omitempty"`
+
+	// Retracts Message this one retracts.
+	Retracts *string `json:"retracts,omitempty"`
+
+	// Status amended and entered-in-error mean a later message replaced this one.
+	Status MessageStatusStatus `json:"status"`
+
+	// SupersededBy Amendment or retraction that replaced this message.
+	SupersededBy *string   `json:"supersededBy,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// MessageStatusStatus amended and entered-in-error mean a later message replaced this one.
+type MessageStatusStatus string
+
 // NarrativeBlock A free-text narrative section mapped to a ClinicalImpression resource with a Record Standard Headings tag.
 type NarrativeBlock struct {
-	// HeadingCode Record Standard Headings code (e.g. clinical-summary, history).
-	HeadingCode NarrativeBlockHeadingCode `json:"headingCode"`
+	// ContextEncounterRef Encounter ID this narrative belongs to. Defaults to the primary encounter.
+	ContextEncounterRef *string `json:"contextEncounterRef,omitempty"`
+
+	// HeadingCode Record Standard Headings code (https://fhir.nhs.uk/CodeSystem/RecordStandardHeadings), e.g.
+	// clinical-summary, history, plan-and-requested-actions. Each heading becomes a Composition.section.
+	HeadingCode string `json:"headingCode"`
 
 	// HeadingDisplay Human readable heading text.
 	HeadingDisplay *string `json:"headingDisplay,omitempty"`
 
+	// SourceId The sending system's own ID for this note. Becomes its identifier under the provider identifier system and fixes its resource id, so a resend describes the same note.
+	SourceId *string `json:"sourceId,omitempty"`
+
 	// Text Narrative body.
 	Text string `json:"text"`
 }
 
-// NarrativeBlockHeadingCode Record Standard Headings code (e.g. clinical-summary, history).
-type NarrativeBlockHeadingCode string
-
 // ObservationComponent defines model for ObservationComponent.
 type ObservationComponent struct {
-	Code                 CodedItem  `json:"code"`
-	ValueCodeableConcept *CodedItem `json:"valueCodeableConcept,omitempty"`
-	ValueQuantity        *Quantity  `json:"valueQuantity,omitempty"`
+	Code                 CodedItem         `json:"code"`
+	Interpretation       *CodedItem        `json:"interpretation,omitempty"`
+	ReferenceRange       *[]ReferenceRange `json:"referenceRange,omitempty"`
+	ValueCodeableConcept *CodedItem        `json:"valueCodeableConcept,omitempty"`
+	ValueQuantity        *Quantity         `json:"valueQuantity,omitempty"`
 }
 
 // ObservationInput defines model for ObservationInput.
@@ -265,25 +544,55 @@ type ObservationInput struct {
 	Code       CodedItem               `json:"code"`
 	Components *[]ObservationComponent `json:"components,omitempty"`
 
-	// ContextEncounterRef Encounter UUID
+	// ContextEncounterRef Encounter ID (encounters[].id); defaults to the primary encounter
 	ContextEncounterRef string    `json:"contextEncounterRef"`
 	EffectiveDateTime   time.Time `json:"effectiveDateTime"`
 
+	// HeadingTag Record Standard Heading the observation is filed under. Defaults from the category
+	// (vital-signs and exam go to examination-findings, laboratory to investigation-results).
+	HeadingTag *CodedItem `json:"headingTag,omitempty"`
+
 	// Id Client-supplied UUID to reference from Composition.section
-	Id     string     `json:"id"`
-	Issued *time.Time `json:"issued,omitempty"`
+	Id string `json:"id"`
 
-	// PerformerRef Practitioner UUID
-	PerformerRef *string                `json:"performerRef,omitempty"`
-	Status       ObservationInputStatus `json:"status"`
+	// Interpretation High/low/normal flag (http://hl7.org/fhir/v2/0078). Derived for known codes when the
+	// gateway interpretation rules are enabled and none is supplied.
+	Interpretation *CodedItem `json:"interpretation,omitempty"`
+	Issued         *time.Time `json:"issued,omitempty"`
+
+	// PerformerRef Participant ID (provenance.participants[].id); defaults to the first performer
+	PerformerRef   *string           `json:"performerRef,omitempty"`
+	ReferenceRange *[]ReferenceRange `json:"referenceRange,omitempty"`
+
+	// SourceId The sending system's own ID for this observation. Becomes its identifier under the provider identifier system and fixes its resource id, so a resend describes the same observation.
+	SourceId *string                `json:"sourceId,omitempty"`
+	Status   ObservationInputStatus `json:"status"`
 
 	// SubjectRef Patient UUID
-	SubjectRef string `json:"subjectRef"`
+	SubjectRef           string     `json:"subjectRef"`
+	ValueBoolean         *bool      `json:"valueBoolean,omitempty"`
+	ValueCodeableConcept *CodedItem `json:"valueCodeableConcept,omitempty"`
+	ValuePeriod          *Period    `json:"valuePeriod,omitempty"`
+	ValueQuantity        *Quantity  `json:"valueQuantity,omitempty"`
+	ValueString          *string    `json:"valueString,omitempty"`
 }
 
 // ObservationInputStatus defines model for ObservationInput.Status.
 type ObservationInputStatus string
 
+// Participant defines model for Participant.
+type Participant struct {
+	// Id Client-supplied ID referenced by observations[].performerRef
+	Id           string `json:"id"`
+	Practitioner Author `json:"practitioner"`
+
+	// Roles Recorders and performers join the Encounter; performers default as Observation.performer; authorisers become Composition.author.
+	Roles []ParticipantRoles `json:"roles"`
+}
+
+// ParticipantRoles defines model for Participant.Roles.
+type ParticipantRoles string
+
 // Patient defines model for Patient.
 type Patient struct {
 	DateOfBirth openapi_types.Date `json:"dateOfBirth"`
@@ -300,26 +609,213 @@ type Patient struct {
 // PatientGender defines model for Patient.Gender.
 type PatientGender string
 
+// Period defines model for Period.
+type Period struct {
+	End   *time.Time `json:"end,omitempty"`
+	Start *time.Time `json:"start,omitempty"`
+}
+
+// PersonName defines model for PersonName.
+type PersonName struct {
+	Family string    `json:"family"`
+	Given  *[]string `json:"given,omitempty"`
+
+	// Prefix Title such as Dr or Prof
+	Prefix *string `json:"prefix,omitempty"`
+
+	// Suffix Post-nominals such as MRPharmS
+	Suffix *string `json:"suffix,omitempty"`
+}
+
+// PharmacyFirstConsultation NHS Pharmacy First clinical pathway consultation. Validated against the pathway's
+// gateway criteria before the message is built.
+type PharmacyFirstConsultation struct {
+	// FeverPainScore FeverPAIN score (required for sore-throat).
+	FeverPainScore *int `json:"feverPainScore,omitempty"`
+
+	// Findings Coded clinical findings supporting the pathway (become Observations).
+	Findings *[]CodedItem `json:"findings,omitempty"`
+
+	// GatewayCriteriaMet All gateway criteria for the pathway were met.
+	GatewayCriteriaMet bool                             `json:"gatewayCriteriaMet"`
+	Outcome            PharmacyFirstConsultationOutcome `json:"outcome"`
+	Pathway            PharmacyFirstConsultationPathway `json:"pathway"`
+
+	// ReferralReason Why the patient was referred onward (required for onward-referral).
+	ReferralReason *string `json:"referralReason,omitempty"`
+
+	// Supply Medication supplied under the pathway PGD (required for outcome=supply).
+	Supply *[]MedicationSupplied `json:"supply,omitempty"`
+
+	// SymptomDurationDays Days since symptom onset (required for sinusitis).
+	SymptomDurationDays *int `json:"symptomDurationDays,omitempty"`
+}
+
+// PharmacyFirstConsultationOutcome defines model for PharmacyFirstConsultation.Outcome.
+type PharmacyFirstConsultationOutcome string
+
+// PharmacyFirstConsultationPathway defines model for PharmacyFirstConsultation.Pathway.
+type PharmacyFirstConsultationPathway string
+
+// ProcedureInput An intervention performed during the consultation, e.g. ABPM fitted or ear irrigation.
+type ProcedureInput struct {
+	BodySite *CodedItem `json:"bodySite,omitempty"`
+	Code     CodedItem  `json:"code"`
+
+	// ContextEncounterRef Encounter ID (encounters[].id); defaults to the primary encounter
+	ContextEncounterRef *string `json:"contextEncounterRef,omitempty"`
+
+	// HeadingTag Record Standard Heading the procedure is filed under. Defaults to procedures.
+	HeadingTag *CodedItem `json:"headingTag,omitempty"`
+
+	// Id Client-supplied ID for the procedure
+	Id                *string    `json:"id,omitempty"`
+	Note              *string    `json:"note,omitempty"`
+	Outcome           *CodedItem `json:"outcome,omitempty"`
+	PerformedDateTime time.Time  `json:"performedDateTime"`
+
+	// Performer Clinician who performed the procedure. Defaults to provenance.author.
+	Performer *Author `json:"performer,omitempty"`
+
+	// SourceId The sending system's own ID for this procedure. Becomes its identifier under the provider identifier system and fixes its resource id, so a resend describes the same procedure.
+	SourceId *string               `json:"sourceId,omitempty"`
+	Status   *ProcedureInputStatus `json:"status,omitempty"`
+}
+
+// ProcedureInputStatus defines model for ProcedureInput.Status.
+type ProcedureInputStatus string
+
+// ProfessionalRegistration defines model for ProfessionalRegistration.
+type ProfessionalRegistration struct {
+	Number string `json:"number"`
+
+	// Type GPhC and GMC numbers are 7 digits, NMC PINs look like 12A3456B, SDS user IDs are 12 digits
+	Type ProfessionalRegistrationType `json:"type"`
+}
+
+// ProfessionalRegistrationType GPhC and GMC numbers are 7 digits, NMC PINs look like 12A3456B, SDS user IDs are 12 digits
+type ProfessionalRegistrationType string
+
 // Provenance defines model for Provenance.
 type Provenance struct {
-	Author Author            `json:"author"`
+	Author Author `json:"author"`
+
+	// IncludeResource Add a FHIR Provenance resource recording the author, system and signature time.
+	IncludeResource *bool `json:"includeResource,omitempty"`
+
+	// Participants Everyone involved in the consultation, e.g. a technician taking readings and a pharmacist signing off. Without participants the author is the recorder, performer and authoriser.
+	Participants *[]Participant `json:"participants,omitempty"`
+
+	// SignedAt When the author signed off the record. Defaults to the time of the update.
+	SignedAt *time.Time `json:"signedAt,omitempty"`
+
+	// System The pharmacy system sending the update; rendered as a Device and on MessageHeader.source, with its ASID as a source extension.
 	System *SystemProvenance `json:"system,omitempty"`
 }
 
 // Quantity defines model for Quantity.
 type Quantity struct {
-	Code   *string `json:"code,omitempty"`
-	System *string `json:"system,omitempty"`
-	Unit   *string `json:"unit,omitempty"`
-	Value  float32 `json:"value"`
+	Code   *string     `json:"code,omitempty"`
+	System *string     `json:"system,omitempty"`
+	Unit   *string     `json:"unit,omitempty"`
+	Value  json.Number `json:"value"`
+}
+
+// ReferenceRange defines model for ReferenceRange.
+type ReferenceRange struct {
+	High *Quantity `json:"high,omitempty"`
+	Low  *Quantity `json:"low,omitempty"`
+
+	// Text Text based reference range
+	Text *string `json:"text,omitempty"`
 }
 
+// ReferralInput An onward referral, e.g. to a GP appointment within 7 days after a high blood pressure reading.
+type ReferralInput struct {
+	// AuthoredOn When the referral was made. Defaults to the time of the update.
+	AuthoredOn *time.Time `json:"authoredOn,omitempty"`
+
+	// ContextEncounterRef Encounter ID (encounters[].id); defaults to the primary encounter
+	ContextEncounterRef *string `json:"contextEncounterRef,omitempty"`
+
+	// Description Free-text instructions for the recipient
+	Description *string `json:"description,omitempty"`
+
+	// DueBy Latest time the recipient should act by
+	DueBy *time.Time `json:"dueBy,omitempty"`
+
+	// DueWithinDays Alternative to dueBy counted from authoredOn
+	DueWithinDays *int `json:"dueWithinDays,omitempty"`
+
+	// HeadingTag Record Standard Heading the referral is filed under. Defaults to referrals.
+	HeadingTag *CodedItem `json:"headingTag,omitempty"`
+
+	// Id Client-supplied ID for the referral
+	Id       *string               `json:"id,omitempty"`
+	Priority ReferralInputPriority `json:"priority"`
+
+	// Reason Why the patient is being referred.
+	Reason CodedItem `json:"reason"`
+
+	// RecipientODS ODS code of the organisation asked to act on the referral
+	RecipientODS string `json:"recipientODS"`
+
+	// Requester Clinician making the referral. Defaults to provenance.author.
+	Requester        *Author    `json:"requester,omitempty"`
+	ServiceRequested *CodedItem `json:"serviceRequested,omitempty"`
+
+	// SourceId The sending system's own ID for this referral. Becomes its identifier under the provider identifier system and fixes its resource id, so a resend describes the same referral.
+	SourceId *string `json:"sourceId,omitempty"`
+}
+
+// ReferralInputPriority defines model for ReferralInput.Priority.
+type ReferralInputPriority string
+
 // Routing defines model for Routing.
 type Routing struct {
 	// RegisteredPracticeODS ODS code of the patient’s registered practice.
 	RegisteredPracticeODS string `json:"registeredPracticeODS"`
 }
 
+// ServiceInput Simple service values. The named template expands them into the coded composition,
+// encounter reason and observations before the message is built.
+type ServiceInput struct {
+	// TakenAt When the readings were taken; defaults to the encounter occurredAt.
+	TakenAt  *time.Time           `json:"takenAt,omitempty"`
+	Template ServiceInputTemplate `json:"template"`
+	Values   *ServiceValues       `json:"values,omitempty"`
+}
+
+// ServiceInputTemplate defines model for ServiceInput.Template.
+type ServiceInputTemplate string
+
+// ServiceValues defines model for ServiceValues.
+type ServiceValues struct {
+	// Arm Arm the blood pressure was taken on.
+	Arm *ServiceValuesArm `json:"arm,omitempty"`
+
+	// Diastolic Diastolic pressure in mm[Hg]
+	Diastolic *json.Number `json:"diastolic,omitempty"`
+
+	// HeartRate Heart rate in beats per minute
+	HeartRate  *json.Number `json:"heartRate,omitempty"`
+	HeightCm   *json.Number `json:"heightCm,omitempty"`
+	Medication *CodedItem   `json:"medication,omitempty"`
+
+	// Pregnant Pregnancy status confirmed with the patient.
+	Pregnant *bool `json:"pregnant,omitempty"`
+
+	// SupplyMade Whether a supply was made (contraception).
+	SupplyMade *bool `json:"supplyMade,omitempty"`
+
+	// Systolic Systolic pressure in mm[Hg]
+	Systolic *json.Number `json:"systolic,omitempty"`
+	WeightKg *json.Number `json:"weightKg,omitempty"`
+}
+
+// ServiceValuesArm Arm the blood pressure was taken on.
+type ServiceValuesArm string
+
 // SubmitAccepted defines model for SubmitAccepted.
 type SubmitAccepted struct {
 	Links *struct {
@@ -334,15 +830,23 @@ type SubmitAccepted struct {
 // SubmitAcceptedStatus defines model for SubmitAccepted.Status.
 type SubmitAcceptedStatus string
 
-// SystemProvenance defines model for SystemProvenance.
+// SystemProvenance The pharmacy system sending the update; rendered as a Device and on MessageHeader.source, with its ASID as a source extension.
 type SystemProvenance struct {
-	Asid *string `json:"asid,omitempty"`
-	Name string  `json:"name"`
+	// Asid Spine Accredited System ID of the sending system. Defaults to the tenant's ASID and must match it when given.
+	Asid         *string `json:"asid,omitempty"`
+	Manufacturer *string `json:"manufacturer,omitempty"`
+
+	// Name This installation of the system (MessageHeader.source.name).
+	Name string `json:"name"`
+
+	// Software The product it runs (MessageHeader.source.software).
+	Software *string `json:"software,omitempty"`
+	Version  *string `json:"version,omitempty"`
 }
 
 // UpdateRecordRequest Full payload; minimal must-haves are required.
 type UpdateRecordRequest struct {
-	// Attachments Optional attachments (become DocumentReference).
+	// Attachments Not supported yet; a request with attachments is rejected rather than sent without them.
 	Attachments     *[]Attachment   `json:"attachments,omitempty"`
 	ClinicalSummary ClinicalSummary `json:"clinicalSummary"`
 
@@ -353,7 +857,10 @@ type UpdateRecordRequest struct {
 	Encounter *Encounter `json:"encounter,omitempty"`
 
 	// Encounters Multiple encounters; one should be role=primary (first is used if none marked).
-	Encounters           *[]EncounterWithRole  `json:"encounters,omitempty"`
+	Encounters *[]EncounterWithRole `json:"encounters,omitempty"`
+
+	// Immunizations Vaccinations given or declined during the consultation (CareConnect Immunization resources).
+	Immunizations        *[]ImmunizationInput  `json:"immunizations,omitempty"`
 	MessageHeaderOptions *MessageHeaderOptions `json:"messageHeaderOptions,omitempty"`
 
 	// NarrativeSections Additional narrative sections (ClinicalImpressions) by Record Standard Heading.
@@ -362,10 +869,60 @@ type UpdateRecordRequest struct {
 	// Observations Observation resources referenced from Composition.section.
 	Observations *[]ObservationInput `json:"observations,omitempty"`
 	Patient      Patient             `json:"patient"`
-	Provenance   Provenance          `json:"provenance"`
-	Routing      Routing             `json:"routing"`
+
+	// PharmacyFirst NHS Pharmacy First clinical pathway consultation. Validated against the pathway's
+	// gateway criteria before the message is built.
+	PharmacyFirst *PharmacyFirstConsultation `json:"pharmacyFirst,omitempty"`
+
+	// Procedures Procedures performed during the consultation (CareConnect Procedure resources).
+	Procedures *[]ProcedureInput `json:"procedures,omitempty"`
+	Provenance Provenance        `json:"provenance"`
+
+	// Referrals Onward referrals the registered practice should action (CareConnect ReferralRequest resources).
+	Referrals *[]ReferralInput `json:"referrals,omitempty"`
+	Routing   Routing          `json:"routing"`
+
+	// Service Simple service values. The named template expands them into the coded composition,
+	// encounter reason and observations before the message is built.
+	Service *ServiceInput `json:"service,omitempty"`
 }
 
+// MessageId defines model for MessageId.
+type MessageId = string
+
+// GetAuditEntriesParams defines parameters for GetAuditEntries.
+type GetAuditEntriesParams struct {
+	MessageId     *string `form:"messageId,omitempty" json:"messageId,omitempty"`
+	ClientId      *string `form:"clientId,omitempty" json:"clientId,omitempty"`
+	CorrelationId *string `form:"correlationId,omitempty" json:"correlationId,omitempty"`
+
+	// NhsNumber Matched by its keyed hash; never stored.
+	NhsNumber *string                     `form:"nhsNumber,omitempty" json:"nhsNumber,omitempty"`
+	Event     *GetAuditEntriesParamsEvent `form:"event,omitempty" json:"event,omitempty"`
+
+	// From Entries at or after this time.
+	From *time.Time `form:"from,omitempty" json:"from,omitempty"`
+
+	// To Entries before this time.
+	To    *time.Time `form:"to,omitempty" json:"to,omitempty"`
+	Limit *int       `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// GetAuditEntriesParamsEvent defines parameters for GetAuditEntries.
+type GetAuditEntriesParamsEvent string
+
+// SubmitMessageParams defines parameters for SubmitMessage.
+type SubmitMessageParams struct {
+	// IdempotencyKey Idempotency token; same key+body returns the original result.
+	IdempotencyKey *string `json:"Idempotency-Key,omitempty"`
+
+	// XCorrelationID Optional correlation id echoed in logs and responses.
+	XCorrelationID *string `json:"X-Correlation-ID,omitempty"`
+}
+
+// SubmitMessageParamsMessageType defines parameters for SubmitMessage.
+type SubmitMessageParamsMessageType string
+
 // SubmitUpdateRecordParams defines parameters for SubmitUpdateRecord.
 type SubmitUpdateRecordParams struct {
 	// IdempotencyKey Idempotency token; same key+body returns the original result.
@@ -375,5 +932,14 @@ type SubmitUpdateRecordParams struct {
 	XCorrelationID *string `json:"X-Correlation-ID,omitempty"`
 }
 
+// SubmitMessageJSONRequestBody defines body for SubmitMessage for application/json ContentType.
+type SubmitMessageJSONRequestBody = UpdateRecordRequest
+
 // SubmitUpdateRecordJSONRequestBody defines body for SubmitUpdateRecord for application/json ContentType.
 type SubmitUpdateRecordJSONRequestBody = UpdateRecordRequest
+
+// AmendMessageJSONRequestBody defines body for AmendMessage for application/json ContentType.
+type AmendMessageJSONRequestBody = CorrectionRequest
+
+// RetractMessageJSONRequestBody defines body for RetractMessage for application/json ContentType.
+type RetractMessageJSONRequestBody = CorrectionRequest
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/audit"
+)
+
+// auditTrail writes request events to the audit log, keying NHS numbers.
+type auditTrail struct {
+	log    auditLog
+	nhsKey []byte
+}
+
+// auditLog is the part of *audit.Log the service uses.
+type auditLog interface {
+	Append(audit.Entry) (audit.Entry, error)
+	Query(match func(audit.Entry) bool) (audit.Result, error)
+}
+
+type auditKey struct{}
+
+// auditNote collects what the auth layer and the handler learn while serving
+// a request, so the entries written for it carry the client and patient.
+type auditNote struct {
+	trail     *auditTrail
+	base      audit.Entry
+	body      *hashingBody
+	clientID  string
+	nhsNumber string
+}
+
+// recordAudit writes entries to the request's audit trail straight away.
+// Handlers call it before any side effect the entries describe (claiming a
+// fingerprint, storing the message, keeping an idempotent response) and
+// answer 503 without those when it fails.
+func recordAudit(ctx context.Context, entries ...audit.Entry) error {
+	n, ok := ctx.Value(auditKey{}).(*auditNote)
+	if !ok {
+		return nil
+	}
+	base := n.base
+	base.ClientID = n.clientID
+	base.PayloadHash = hex.EncodeToString(n.body.h.Sum(nil))
+	base.NHSNumberHash = audit.HashNHSNumber(n.trail.nhsKey, n.nhsNumber)
+	for _, e := range entries {
+		if _, err := n.trail.log.Append(merge(base, e)); err != nil {
+			log.Printf("audit: %s %s for %s: %v", e.Event, e.MessageID, base.CorrelationID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// noteAuditClient records who the request came from, once authenticated.
+func noteAuditClient(ctx context.Context, clientID string) {
+	if n, ok := ctx.Value(auditKey{}).(*auditNote); ok {
+		n.clientID = clientID
+	}
+}
+
+// noteAuditPatient records whose record the request is, once decoded.
+func noteAuditPatient(ctx context.Context, nhsNumber string) {
+	if n, ok := ctx.Value(auditKey{}).(*auditNote); ok {
+		n.nhsNumber = nhsNumber
+	}
+}
+
+// withAudit records a request in the audit log: received before anything
+// else runs, what the handler records as it goes (built, status changes,
+// replayed), and why the request was rejected when it was. It sits outside
+// authentication so refused tokens are recorded too; received is written
+// before the client is known, and the entries after it, under the same
+// correlation ID, carry it. The response is held back until the rejection
+// is written, and a request that can't be audited gets a 503 instead.
+func withAudit(trail *auditTrail, action string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlate(w, r)
+		base := audit.Entry{
+			CorrelationID: w.Header().Get("X-Correlation-ID"),
+			Action:        action,
+			MessageType:   r.PathValue("messageType"),
+			RelatedID:     r.PathValue("messageId"),
+		}
+		received := base
+		received.Event, received.Time = audit.Received, time.Now()
+		if _, err := trail.log.Append(received); err != nil {
+			log.Printf("audit: %v", err)
+			writeAuditUnavailable(w)
+			return
+		}
+
+		body := &hashingBody{ReadCloser: r.Body, h: sha256.New()}
+		r.Body = body
+		note := &auditNote{trail: trail, base: base, body: body}
+		rec := &auditRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, note)))
+
+		if rec.status >= 400 {
+			if err := recordAudit(context.WithValue(r.Context(), auditKey{}, note), rejectedEntry(rec)); err != nil {
+				// nothing the handler set applies to this response
+				clear(w.Header())
+				w.Header().Set("X-Correlation-ID", base.CorrelationID)
+				writeAuditUnavailable(w)
+				return
+			}
+		}
+		rec.send()
+	})
+}
+
+// writeAuditUnavailable answers a request whose entries couldn't be written.
+func writeAuditUnavailable(w http.ResponseWriter) {
+	writeErr(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "audit log unavailable")
+}
+
+// rejectedEntry describes an error response from its body.
+func rejectedEntry(rec *auditRecorder) audit.Entry {
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Details struct {
+				OriginalMessageID string `json:"originalMessageId"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(rec.body.Bytes(), &body)
+	return audit.Entry{
+		Event:      audit.Rejected,
+		HTTPStatus: rec.status,
+		ErrorCode:  body.Error.Code,
+		Detail:     body.Error.Message,
+		RelatedID:  body.Error.Details.OriginalMessageID,
+	}
+}
+
+// merge fills e's unset request fields from base.
+func merge(base, e audit.Entry) audit.Entry {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&e.ClientID, base.ClientID},
+		{&e.CorrelationID, base.CorrelationID},
+		{&e.Action, base.Action},
+		{&e.MessageType, base.MessageType},
+		{&e.RelatedID, base.RelatedID},
+		{&e.PayloadHash, base.PayloadHash},
+		{&e.NHSNumberHash, base.NHSNumberHash},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.src
+		}
+	}
+	return e
+}
+
+// hashingBody hashes a request body as the handler reads it.
+type hashingBody struct {
+	io.ReadCloser
+	h hash.Hash
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.h.Write(p[:n])
+	return n, err
+}
+
+// auditRecorder holds the response back, status and body, until send.
+// Headers go straight to the real writer, which doesn't send them until then.
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *auditRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// send writes the held response.
+func (w *auditRecorder) send() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
+
+/* ---- Audit query API ---- */
+
+// auditQueryHandler lets information governance reviewers read the log.
+// Filters are ANDed; messageId also matches entries that amend, retract or
+// duplicate the message. The chain is verified on every read, and the query
+// itself is audited.
+func auditQueryHandler(live *atomic.Pointer[settings], trail *auditTrail) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlate(w, r)
+		reviewer, ok := bearerClient(w, r, live.Load().reviewers, "no audit reviewers are configured")
+		if !ok {
+			return
+		}
+
+		q := r.URL.Query()
+		var from, to time.Time
+		var err error
+		if v := q.Get("from"); v != "" {
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", "from must be an RFC 3339 time")
+				return
+			}
+		}
+		if v := q.Get("to"); v != "" {
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", "to must be an RFC 3339 time")
+				return
+			}
+		}
+		limit := 1000
+		if v := q.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > 10000 {
+				writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", "limit must be 1 to 10000")
+				return
+			}
+		}
+		nhsHash := audit.HashNHSNumber(trail.nhsKey, q.Get("nhsNumber"))
+
+		res, err := trail.log.Query(func(e audit.Entry) bool {
+			if id := q.Get("messageId"); id != "" && e.MessageID != id && e.RelatedID != id {
+				return false
+			}
+			if nhsHash != "" && e.NHSNumberHash != nhsHash {
+				return false
+			}
+			for key, v := range map[string]string{"clientId": e.ClientID, "correlationId": e.CorrelationID, "event": e.Event} {
+				if want := q.Get(key); want != "" && v != want {
+					return false
+				}
+			}
+			return (from.IsZero() || !e.Time.Before(from)) && (to.IsZero() || e.Time.Before(to))
+		})
+		if err != nil {
+			writeErr(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", fmt.Sprintf("read audit log: %v", err))
+			return
+		}
+
+		// the query is recorded with the NHS number keyed like everywhere else
+		asked := r.URL.Query()
+		if asked.Has("nhsNumber") {
+			asked.Del("nhsNumber")
+			asked.Set("nhsNumberHash", nhsHash)
+		}
+		if _, err := trail.log.Append(audit.Entry{
+			Event:         audit.Queried,
+			ClientID:      reviewer,
+			CorrelationID: w.Header().Get("X-Correlation-ID"),
+			Detail:        asked.Encode(),
+		}); err != nil {
+			log.Printf("audit: %v", err)
+			writeAuditUnavailable(w)
+			return
+		}
+
+		entries, truncated := res.Entries, false
+		if len(entries) > limit {
+			entries, truncated = entries[:limit], true
+		}
+		chain := map[string]any{
+			"verified": res.Verified,
+			"length":   res.Length,
+			"head":     res.Head,
+		}
+		if !res.Verified {
+			chain["brokenAt"] = res.BrokenAt
+			chain["problem"] = res.Problem
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"entries":   entries,
+			"truncated": truncated,
+			"chain":     chain,
+		})
+	})
+}
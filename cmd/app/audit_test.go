@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/config"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/audit"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/common"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/dedup"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/messages"
+)
+
+const submitBody = `{
+	"patient": {"nhsNumber": "9876543210", "dateOfBirth": "1978-02-17", "surname": "SMITH"},
+	"provenance": {"author": {"name": "Miss Di Spencer"}, "system": {"name": "PMR"}},
+	"routing": {"registeredPracticeODS": "G85001"},
+	"clinicalSummary": {"freeText": "Pulse check"},
+	"encounter": {"occurredAt": "2026-03-08T11:00:00Z"},
+	"observations": [
+		{"id": "o1", "status": "final", "code": {"system": "http://snomed.info/sct", "code": "364075005"}, "effectiveDateTime": "2026-03-08T11:00:00Z", "valueQuantity": {"value": 72, "unit": "per minute", "code": "/min"}}
+	]
+}`
+
+// brokenLog is an audit log that, while down, refuses everything but the
+// received entry, as if the disk filled up mid-request.
+type brokenLog struct {
+	*audit.Log
+	down bool
+}
+
+func (l *brokenLog) Append(e audit.Entry) (audit.Entry, error) {
+	if l.down && e.Event != audit.Received {
+		return audit.Entry{}, errors.New("disk full")
+	}
+	return l.Log.Append(e)
+}
+
+// countingStore counts the messages stored.
+type countingStore struct {
+	messages.Store
+	puts int
+}
+
+func (s *countingStore) Put(r messages.Record) error {
+	s.puts++
+	return s.Store.Put(r)
+}
+
+func TestSubmitNotStoredWhenAuditFails(t *testing.T) {
+	mem, err := audit.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog := &brokenLog{Log: mem, down: true}
+	store := &countingStore{Store: messages.NewMemory()}
+	var live atomic.Pointer[settings]
+	live.Store(&settings{
+		builder:    common.Config{SenderMeshMailbox: "MBX", SenderASID: "200000000115", DefaultSenderODS: "FA123", DefaultRecipientType: "FI"},
+		duplicates: config.Duplicates{Action: dedup.Reject, Window: time.Hour},
+	})
+	h := withAudit(&auditTrail{log: auditLog}, "submit", withAuth(&live, submitHandler(&live, store, dedup.NewIndex(), 1<<20)))
+	submit := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/update-record/messages", strings.NewReader(submitBody))
+		r.Header.Set("Idempotency-Key", t.Name())
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := submit(); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d with the audit log down, want 503: %s", w.Code, w.Body)
+	}
+	if store.puts != 0 {
+		t.Errorf("stored %d messages that weren't audited", store.puts)
+	}
+
+	// neither the idempotent response nor the duplicate claim was kept
+	auditLog.down = false
+	if w := submit(); w.Code != http.StatusAccepted || w.Header().Get("X-Message-ID") == "" {
+		t.Fatalf("retry got %d, want a new message accepted: %s", w.Code, w.Body)
+	}
+	if store.puts != 1 {
+		t.Errorf("retry stored %d messages, want 1", store.puts)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/audit"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/common"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/messages"
+)
+
+// correctionRequest is the body of an amend or retract call. Record is the
+// full corrected request for an amendment and must be absent on a retraction.
+type correctionRequest struct {
+	Reason string          `json:"reason"`
+	Record json.RawMessage `json:"record"`
+}
+
+// correctHandler amends (status amended) or retracts (status entered-in-error)
+// a message sent earlier by the same client. The new message reuses the
+// original resource IDs, retracts what an amendment leaves out, and is
+// linked to the original in the store.
+func correctHandler(live *atomic.Pointer[settings], store messages.Store, maxBodyBytes int64, status string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlate(w, r)
+		cur := live.Load()
+		clientID := clientFrom(r.Context())
+
+		orig, ok := ownMessage(w, store, r.PathValue("messageId"), clientID)
+		if !ok {
+			return
+		}
+		if !orig.Correctable() {
+			writeErr(w, http.StatusConflict, "MESSAGE_SUPERSEDED", supersededMessage(orig))
+			return
+		}
+		mt, ok := common.LookupMessageType(orig.MessageType)
+		if !ok || mt.Correct == nil {
+			writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("%s messages can't be amended or retracted", orig.MessageType))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("read body: %v", err))
+			return
+		}
+		var in correctionRequest
+		if len(strings.TrimSpace(string(body))) > 0 {
+			if err := json.Unmarshal(body, &in); err != nil {
+				writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("invalid JSON: %v", err))
+				return
+			}
+		}
+
+		// an amendment carries the corrected record; a retraction rebuilds the original
+		raw := []byte(in.Record)
+		switch {
+		case status == common.CorrectionAmended && len(raw) == 0:
+			writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", "record is required to amend a message")
+			return
+		case status == common.CorrectionEnteredInError && len(raw) > 0:
+			writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", "record must not be sent to retract a message")
+			return
+		case status == common.CorrectionEnteredInError:
+			raw = orig.Request
+		}
+		req, err := mt.Decode(raw)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("invalid record: %v", err))
+			return
+		}
+		noteAuditPatient(r.Context(), mt.NHSNumber(req))
+		prev, err := mt.Decode(orig.Request)
+		if err != nil {
+			writeErr(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", fmt.Sprintf("read original message: %v", err))
+			return
+		}
+
+		cfg, err := senderConfig(cur, clientID, mt, req)
+		if err != nil {
+			writeErr(w, http.StatusForbidden, "FORBIDDEN", err.Error())
+			return
+		}
+		res, err := mt.Correct(req, cfg, common.Correction{
+			Status:           status,
+			Reason:           in.Reason,
+			ReplacesDocument: orig.DocumentID,
+			ResourceIDs:      orig.ResourceIDs,
+			Original:         prev,
+		})
+		if errors.Is(err, common.ErrCorrectionMismatch) {
+			writeErr(w, http.StatusConflict, "CORRECTION_MISMATCH", err.Error())
+			return
+		}
+		if err != nil {
+			writeErr(w, http.StatusUnprocessableEntity, "FHIR_VALIDATION_FAILED", err.Error())
+			return
+		}
+
+		next := messages.Record{
+			MessageID:   uuid.New().String(),
+			MessageType: mt.Name,
+			ClientID:    clientID,
+			Status:      messages.Accepted,
+			Request:     raw,
+			DocumentID:  res.DocumentID,
+			ResourceIDs: res.ResourceIDs,
+			Reason:      in.Reason,
+		}
+		newStatus := messages.Amended
+		if status == common.CorrectionEnteredInError {
+			next.Retracts, newStatus = orig.MessageID, messages.EnteredInError
+		} else {
+			next.Amends = orig.MessageID
+		}
+		// audited before the store changes, so no correction goes unrecorded
+		if err := recordAudit(r.Context(),
+			audit.Entry{
+				Event:       audit.Built,
+				MessageID:   next.MessageID,
+				MessageType: mt.Name,
+				RelatedID:   orig.MessageID,
+				FHIRHash:    audit.Hash(res.XML),
+				DocumentID:  res.DocumentID,
+				MeshMailbox: cfg.SenderMeshMailbox,
+			},
+			audit.Entry{Event: audit.Status, MessageID: next.MessageID, MessageType: mt.Name, ToStatus: string(messages.Accepted)},
+			audit.Entry{
+				Event:       audit.Status,
+				MessageID:   orig.MessageID,
+				MessageType: mt.Name,
+				RelatedID:   next.MessageID,
+				FromStatus:  string(orig.Status),
+				ToStatus:    string(newStatus),
+				Detail:      in.Reason,
+			}); err != nil {
+			writeAuditUnavailable(w)
+			return
+		}
+		if err := store.Supersede(orig.MessageID, newStatus, next); err != nil {
+			if errors.Is(err, messages.ErrNotCorrectable) {
+				// another correction got there first
+				writeErr(w, http.StatusConflict, "MESSAGE_SUPERSEDED", err.Error())
+				return
+			}
+			writeErr(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", fmt.Sprintf("record message: %v", err))
+			return
+		}
+		writeBuilt(w, next.MessageID, res)
+	})
+}
+
+// statusHandler reports a message's status and how it links to amendments
+// and retractions.
+func statusHandler(store messages.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlate(w, r)
+		rec, ok := ownMessage(w, store, r.PathValue("messageId"), clientFrom(r.Context()))
+		if !ok {
+			return
+		}
+		resp := map[string]any{
+			"messageId":   rec.MessageID,
+			"messageType": rec.MessageType,
+			"status":      rec.Status,
+			"createdAt":   rec.CreatedAt.UTC().Format(time.RFC3339),
+			"updatedAt":   rec.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		links := map[string]string{"self": messagePath(rec.MessageID)}
+		for key, id := range map[string]string{"amends": rec.Amends, "retracts": rec.Retracts, "supersededBy": rec.SupersededBy, "duplicateOf": rec.DuplicateOf} {
+			if id != "" {
+				resp[key] = id
+				links[key] = messagePath(id)
+			}
+		}
+		if rec.Reason != "" {
+			resp["reason"] = rec.Reason
+		}
+		resp["links"] = links
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// ownMessage loads a message, answering 404 when it doesn't exist or was
+// sent by another client.
+func ownMessage(w http.ResponseWriter, store messages.Store, id, clientID string) (messages.Record, bool) {
+	rec, err := store.Get(id)
+	if err == nil && rec.ClientID != clientID {
+		err = messages.ErrNotFound
+	}
+	switch {
+	case errors.Is(err, messages.ErrNotFound):
+		writeErr(w, http.StatusNotFound, "MESSAGE_NOT_FOUND", fmt.Sprintf("message %q not found", id))
+		return rec, false
+	case err != nil:
+		writeErr(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", err.Error())
+		return rec, false
+	}
+	return rec, true
+}
+
+func supersededMessage(rec messages.Record) string {
+	switch {
+	case rec.Retracts != "":
+		return fmt.Sprintf("message %s is a retraction and can't be corrected", rec.MessageID)
+	case rec.SupersededBy != "":
+		return fmt.Sprintf("message %s is %s; correct the latest message %s instead", rec.MessageID, rec.Status, rec.SupersededBy)
+	}
+	return fmt.Sprintf("message %s can't be corrected", rec.MessageID)
+}
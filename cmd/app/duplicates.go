@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/dedup"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/messages"
+)
+
+// stillStands reports whether an earlier message still counts against a
+// resend: it, or the amendment that replaced it, hasn't been retracted.
+// Once retracted, the same content can be sent again.
+func stillStands(store messages.Store) func(messageID string) bool {
+	return func(messageID string) bool {
+		for id := messageID; ; {
+			rec, err := store.Get(id)
+			switch {
+			case errors.Is(err, messages.ErrNotFound):
+				return false
+			case err != nil:
+				return true // can't tell; err on the side of not sending twice
+			case rec.Status == messages.Amended && rec.SupersededBy != "":
+				id = rec.SupersededBy
+			default:
+				return rec.Status != messages.EnteredInError
+			}
+		}
+	}
+}
+
+// writeDuplicate refuses a message whose content matches one already sent,
+// pointing at the original so the client can check or amend it instead.
+func writeDuplicate(w http.ResponseWriter, orig dedup.Match) {
+	writeErrDetails(w, http.StatusConflict, "DUPLICATE_SUBMISSION",
+		fmt.Sprintf("same patient, encounter time, record type and clinical entries as message %s sent at %s; amend that message to change it",
+			orig.MessageID, orig.SeenAt.UTC().Format(time.RFC3339)),
+		map[string]any{
+			"originalMessageId": orig.MessageID,
+			"originalSentAt":    orig.SeenAt.UTC().Format(time.RFC3339),
+			"links": map[string]string{
+				"original": messagePath(orig.MessageID) + "/status",
+			},
+		})
+}
+
+// flagDuplicate marks an accepted response as a likely duplicate when the
+// configured action is flag rather than reject.
+func flagDuplicate(w http.ResponseWriter, originalID string) {
+	w.Header().Set("X-Duplicate-Of", originalID)
+	w.Header().Add("Warning", fmt.Sprintf("199 elevate-gpconnect %q", "likely duplicate of message "+originalID))
+}
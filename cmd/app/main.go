@@ -11,14 +11,22 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 
-	gpConnectClient "github.com/Cleo-Systems/elevate-gpconnect/client/http"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/config"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/audit"
 	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/common"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/dedup"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/dmd"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/messages"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/ods"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/tenant"
 )
 
 // --- simple in-memory idempotency cache (process lifetime only) ---
@@ -26,10 +34,12 @@ type idemEntry struct {
 	BodyHash     [32]byte
 	MessageID    string
 	ResponseBody []byte
+	StoredAt     time.Time
 }
 
 type idempotencyStore struct {
-	m sync.Map // key:string => idemEntry
+	m   sync.Map      // key:string => idemEntry
+	ttl time.Duration // 0 keeps entries for the process lifetime
 }
 
 func (s *idempotencyStore) Get(key string) (idemEntry, bool) {
@@ -37,9 +47,15 @@ func (s *idempotencyStore) Get(key string) (idemEntry, bool) {
 	if !ok {
 		return idemEntry{}, false
 	}
-	return v.(idemEntry), true
+	e := v.(idemEntry)
+	if s.ttl > 0 && time.Since(e.StoredAt) > s.ttl {
+		s.m.Delete(key)
+		return idemEntry{}, false
+	}
+	return e, true
 }
 func (s *idempotencyStore) Put(key string, e idemEntry) {
+	e.StoredAt = time.Now()
 	s.m.Store(key, e)
 }
 
@@ -47,26 +63,125 @@ var (
 	idem = &idempotencyStore{}
 )
 
+// settings are the parts of the configuration that can change on SIGHUP.
+type settings struct {
+	builder    common.Config
+	tenants    *tenant.Registry // nil: single sender, no authentication
+	duplicates config.Duplicates
+	reviewers  *tenant.Registry // audit reviewers; nil closes the audit API
+}
+
+func newSettings(conf *config.Config, sites *ods.Directory, medicines *dmd.Dictionary) (*settings, error) {
+	tenants, err := conf.Tenants.Registry()
+	if err != nil {
+		return nil, err
+	}
+	reviewers, err := conf.Audit.ReviewerRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return &settings{
+		builder: common.Config{
+			SenderMeshMailbox:                 conf.MESH.Mailbox,
+			SenderASID:                        conf.MESH.ASID,
+			DefaultSenderODS:                  conf.Routing.DefaultSenderODS,
+			DefaultBusinessAckRequested:       conf.Routing.BusinessAckRequested,
+			DefaultInfrastructureAckRequested: conf.Routing.InfrastructureAckRequested,
+			DefaultRecipientType:              conf.Routing.RecipientType,
+			DeriveInterpretation:              conf.Features.DeriveInterpretation,
+			IdentifierSystem:                  conf.Identifiers.System,
+			Sites:                             sites,
+			Medicines:                         medicines,
+		},
+		tenants:    tenants,
+		duplicates: conf.Duplicates,
+		reviewers:  reviewers,
+	}, nil
+}
+
 func main() {
-	// Config you’d normally load from env/secret manager
-	cfg := common.Config{
-		SenderMeshMailbox:                 getenv("SENDER_MESH_MAILBOX_ID", "SENDER_MESH_MAILBOX_ID"),
-		DefaultSenderODS:                  getenv("DEFAULT_SENDER_ODS", "A(*)"),
-		DefaultBusinessAckRequested:       true,
-		DefaultInfrastructureAckRequested: true,
-		DefaultRecipientType:              "FI",
+	// Settings come from CONFIG_FILE (YAML or JSON) with environment overrides
+	configPath := os.Getenv("CONFIG_FILE")
+	conf, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	ctx, cancelBackground := context.WithCancel(context.Background())
+	defer cancelBackground()
+
+	// Optional local ODS extracts for code checks and Organization/Location
+	// details, re-read every data.odsRefreshInterval
+	var sites *ods.Directory
+	if len(conf.Data.ODSFiles) > 0 {
+		sites, err = ods.LoadFile(conf.Data.ODSFiles...)
+		if err != nil {
+			log.Fatalf("load ODS data: %v", err)
+		}
+		log.Printf("loaded %d ODS records", sites.Len())
+		if every := conf.Data.ODSRefreshInterval; every > 0 {
+			go refreshODS(ctx, sites, every)
+		}
 	}
+	// Optional dm+d release files for medication code checks
+	var medicines *dmd.Dictionary
+	if len(conf.Data.DMDFiles) > 0 {
+		medicines, err = dmd.LoadFile(conf.Data.DMDFiles...)
+		if err != nil {
+			log.Fatalf("load dm+d data: %v", err)
+		}
+		log.Printf("loaded %d dm+d concepts", medicines.Len())
+	}
+
+	var live atomic.Pointer[settings]
+	initial, err := newSettings(conf, sites, medicines)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	live.Store(initial)
+	if initial.tenants != nil {
+		log.Printf("loaded %d tenants", initial.tenants.Len())
+	} else {
+		log.Println("no tenants configured: single sender, no authentication")
+	}
+	idem.ttl = conf.Storage.IdempotencyTTL
+	var store messages.Store = messages.NewMemory() // storage.driver "memory", the only driver
+	dups := dedup.NewIndex()
+
+	// Audit log: a hash-chained file, or memory without audit.file
+	auditLog, err := audit.Open(conf.Audit.File)
+	if err != nil {
+		log.Fatalf("audit log: %v", err)
+	}
+	defer auditLog.Close()
+	nhsKey := []byte(conf.Audit.NHSNumberKey)
+	if len(nhsKey) == 0 {
+		// memory-only log: hashes only need to match within this process
+		nhsKey = []byte(uuid.New().String())
+		log.Println("no audit.file configured: audit log kept in memory")
+	}
+	trail := &auditTrail{log: auditLog, nhsKey: nhsKey}
+
+	go reloadOnHangup(ctx, configPath, conf, &live, sites, medicines)
 
 	mux := http.NewServeMux()
-	mux.Handle("/v1/update-record/messages", postOnly(withJSON(submitHandler(cfg))))
+	submit := postOnly(withJSON(withAudit(trail, "submit", withAuth(&live, submitHandler(&live, store, dups, conf.Server.MaxBodyBytes)))))
+	mux.Handle("/v1/messages/{messageType}", submit)
+	mux.Handle("/v1/update-record/messages", submit) // original path, always Update Record
+	status := withAuth(&live, statusHandler(store))
+	mux.Handle("GET /v1/update-record/messages/{messageId}", status)
+	mux.Handle("GET /v1/update-record/messages/{messageId}/status", status)
+	mux.Handle("POST /v1/update-record/messages/{messageId}/amend", withAudit(trail, "amend", withAuth(&live, correctHandler(&live, store, conf.Server.MaxBodyBytes, common.CorrectionAmended))))
+	mux.Handle("POST /v1/update-record/messages/{messageId}/retract", withAudit(trail, "retract", withAuth(&live, correctHandler(&live, store, conf.Server.MaxBodyBytes, common.CorrectionEnteredInError))))
+	mux.Handle("GET /v1/audit/entries", auditQueryHandler(&live, trail))
 
 	srv := &http.Server{
-		Addr:              getenv("PORT", ":8084"),
+		Addr:              conf.Server.Addr,
 		Handler:           logMiddleware(mux),
-		ReadHeaderTimeout: 5 * time.Second,
-		ReadTimeout:       15 * time.Second,
-		WriteTimeout:      15 * time.Second,
-		IdleTimeout:       60 * time.Second,
+		ReadHeaderTimeout: conf.Server.ReadHeaderTimeout,
+		ReadTimeout:       conf.Server.ReadTimeout,
+		WriteTimeout:      conf.Server.WriteTimeout,
+		IdleTimeout:       conf.Server.IdleTimeout,
 	}
 
 	// graceful shutdown
@@ -82,30 +197,84 @@ func main() {
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	cancelBackground()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
 	defer cancel()
-	_ = srv.Shutdown(ctx)
+	_ = srv.Shutdown(shutdownCtx)
 	log.Println("server stopped")
 }
 
-func submitHandler(cfg common.Config) http.Handler {
+// reloadOnHangup re-reads the configuration on SIGHUP and swaps in the
+// reloadable settings. An invalid file, or one that would turn
+// authentication on or off, keeps the current settings; changes to server,
+// storage or data settings are logged and wait for a restart.
+func reloadOnHangup(ctx context.Context, path string, running *config.Config, live *atomic.Pointer[settings], sites *ods.Directory, medicines *dmd.Dictionary) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		next, err := config.Load(path)
+		if err != nil {
+			log.Printf("reload config: %v; keeping current settings", err)
+			continue
+		}
+		s, err := newSettings(next, sites, medicines)
+		if err != nil {
+			log.Printf("reload config: %v; keeping current settings", err)
+			continue
+		}
+		// turning authentication on or off must be deliberate, not a side
+		// effect of a tenants file that went missing or empty
+		if was, now := live.Load().tenants != nil, s.tenants != nil; was != now {
+			turn := "off"
+			if now {
+				turn = "on"
+			}
+			log.Printf("reload config: would turn authentication %s, which needs a restart; keeping current settings", turn)
+			continue
+		}
+		if changed := next.StructuralChanges(*running); len(changed) > 0 {
+			log.Printf("reload config: %s changes need a restart", strings.Join(changed, ", "))
+		}
+		live.Store(s)
+		log.Printf("reloaded config (%d tenants)", s.tenants.Len())
+	}
+}
+
+func submitHandler(live *atomic.Pointer[settings], store messages.Store, dups *dedup.Index, maxBodyBytes int64) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		corrID := r.Header.Get("X-Correlation-ID")
-		if corrID == "" {
-			corrID = uuid.New().String()
+		correlate(w, r)
+
+		// one snapshot per request so a reload can't split it
+		cur := live.Load()
+
+		name := r.PathValue("messageType")
+		if name == "" {
+			name = "update-record"
+		}
+		mt, ok := common.LookupMessageType(name)
+		if !ok {
+			writeErr(w, http.StatusNotFound, "UNKNOWN_MESSAGE_TYPE", fmt.Sprintf("unknown message type %q (known: %s)", name, strings.Join(common.MessageTypeNames(), ", ")))
+			return
 		}
-		w.Header().Set("X-Correlation-ID", corrID)
 
-		// read body (limit to something sane, e.g. 5MB)
-		r.Body = http.MaxBytesReader(w, r.Body, 5<<20)
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("read body: %v", err))
 			return
 		}
 
-		// idempotency
+		// idempotency, scoped to the client so keys can't collide across tenants
 		idemKey := r.Header.Get("Idempotency-Key")
+		if clientID := clientFrom(r.Context()); idemKey != "" && clientID != "" {
+			idemKey = clientID + ":" + idemKey
+		}
 		bodyHash := sha256.Sum256(body)
 		if idemKey != "" {
 			if prev, ok := idem.Get(idemKey); ok {
@@ -114,6 +283,10 @@ func submitHandler(cfg common.Config) http.Handler {
 					return
 				}
 				// return previous response
+				if err := recordAudit(r.Context(), audit.Entry{Event: audit.Replayed, MessageID: prev.MessageID}); err != nil {
+					writeAuditUnavailable(w)
+					return
+				}
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusAccepted)
 				_, _ = w.Write(prev.ResponseBody)
@@ -121,15 +294,23 @@ func submitHandler(cfg common.Config) http.Handler {
 			}
 		}
 
-		// decode request
-		var req gpConnectClient.UpdateRecordRequest
-		if err := json.Unmarshal(body, &req); err != nil {
+		// decode request into the message type's schema
+		req, err := mt.Decode(body)
+		if err != nil {
 			writeErr(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("invalid JSON: %v", err))
 			return
 		}
+		noteAuditPatient(r.Context(), mt.NHSNumber(req))
 
-		// build FHIR message using your existing builder
-		fhirBytes, err := common.BuildUpdateRecordFHIRXML(req, cfg)
+		clientID := clientFrom(r.Context())
+		cfg, err := senderConfig(cur, clientID, mt, req)
+		if err != nil {
+			writeErr(w, http.StatusForbidden, "FORBIDDEN", err.Error())
+			return
+		}
+
+		// build the FHIR message
+		res, err := mt.Build(req, cfg)
 		if err != nil {
 			writeErr(w, http.StatusUnprocessableEntity, "FHIR_VALIDATION_FAILED", err.Error())
 			return
@@ -138,17 +319,63 @@ func submitHandler(cfg common.Config) http.Handler {
 		// Here you’d enqueue/send to MESH. We’ll just pretend it’s accepted.
 		messageID := uuid.New().String()
 
-		resp := map[string]any{
-			"messageId":     messageID,
-			"status":        "accepted",
-			"meshMessageId": nil, // filled once enqueued to MESH
-			"links": map[string]string{
-				"self":   fmt.Sprintf("/v1/update-record/messages/%s", messageID),
-				"status": fmt.Sprintf("/v1/update-record/messages/%s/status", messageID),
-			},
+		// same clinical content from the same client within the window,
+		// whatever the Idempotency-Key
+		var duplicateOf string
+		checkDup := cur.duplicates.Action != dedup.Off && res.Fingerprint != ""
+		if checkDup {
+			if orig, found := dups.Claim(clientID, res.Fingerprint, messageID, cur.duplicates.Window, stillStands(store)); found {
+				if cur.duplicates.Action == dedup.Reject {
+					writeDuplicate(w, orig)
+					return
+				}
+				duplicateOf = orig.MessageID
+				checkDup = false // the claim stays with the original
+			}
 		}
 
-		respBytes, _ := json.Marshal(resp)
+		// audited before it's stored, so no message is accepted unrecorded
+		built := audit.Entry{
+			Event:       audit.Built,
+			MessageID:   messageID,
+			MessageType: mt.Name,
+			FHIRHash:    audit.Hash(res.XML),
+			DocumentID:  res.DocumentID,
+			MeshMailbox: cfg.SenderMeshMailbox,
+		}
+		if duplicateOf != "" {
+			built.RelatedID, built.Detail = duplicateOf, "likely duplicate"
+		}
+		if err := recordAudit(r.Context(), built,
+			audit.Entry{Event: audit.Status, MessageID: messageID, MessageType: mt.Name, ToStatus: string(messages.Accepted)}); err != nil {
+			if checkDup {
+				dups.Release(clientID, res.Fingerprint, messageID)
+			}
+			writeAuditUnavailable(w)
+			return
+		}
+
+		if err := store.Put(messages.Record{
+			MessageID:   messageID,
+			MessageType: mt.Name,
+			ClientID:    clientID,
+			Status:      messages.Accepted,
+			Request:     body,
+			DocumentID:  res.DocumentID,
+			ResourceIDs: res.ResourceIDs,
+			DuplicateOf: duplicateOf,
+		}); err != nil {
+			if checkDup {
+				dups.Release(clientID, res.Fingerprint, messageID)
+			}
+			writeErr(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", fmt.Sprintf("record message: %v", err))
+			return
+		}
+		if duplicateOf != "" {
+			flagDuplicate(w, duplicateOf)
+		}
+
+		respBytes, _ := json.Marshal(acceptedResponse(messageID))
 
 		// store idempotent result
 		if idemKey != "" {
@@ -160,17 +387,108 @@ func submitHandler(cfg common.Config) http.Handler {
 		}
 
 		// (Optional) log the built FHIR message (redact in real life)
-		//log.Printf("built FHIR message for %s (bytes=%d)", messageID, len(fhirBytes))
-		//log.Printf(string(fhirBytes))
+		//log.Printf("built FHIR message for %s (bytes=%d)", messageID, len(res.XML))
+		//log.Printf(string(res.XML))
 
-		w.Header().Set("Content-Type", "text/xml")
-		w.WriteHeader(http.StatusAccepted)
-		_, _ = w.Write(fhirBytes)
+		writeBuilt(w, messageID, res)
 	})
 }
 
+// senderConfig picks the sender's tenant from the client and the request's
+// performer ODS. Without tenants the configured single sender is used.
+func senderConfig(cur *settings, clientID string, mt common.MessageType, req any) (common.Config, error) {
+	if cur.tenants == nil {
+		return cur.builder, nil
+	}
+	t, err := cur.tenants.Resolve(clientID, mt.SenderODS(req))
+	if err != nil {
+		return common.Config{}, err
+	}
+	return tenantConfig(cur.builder, t), nil
+}
+
+func acceptedResponse(messageID string) map[string]any {
+	return map[string]any{
+		"messageId":     messageID,
+		"status":        "accepted",
+		"meshMessageId": nil, // filled once enqueued to MESH
+		"links": map[string]string{
+			"self":   messagePath(messageID),
+			"status": messagePath(messageID) + "/status",
+		},
+	}
+}
+
+func messagePath(messageID string) string {
+	return fmt.Sprintf("/v1/update-record/messages/%s", messageID)
+}
+
+// writeBuilt returns the built message, with its ID and status link in
+// headers and any build warnings as Warning headers.
+func writeBuilt(w http.ResponseWriter, messageID string, res *common.BuildResult) {
+	w.Header().Set("X-Message-ID", messageID)
+	w.Header().Set("Location", messagePath(messageID)+"/status")
+	for _, wn := range res.Warnings {
+		w.Header().Add("Warning", fmt.Sprintf("199 elevate-gpconnect %q", wn.String()))
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write(res.XML)
+}
+
+// tenantConfig overlays a tenant's sender settings on the base config.
+func tenantConfig(base common.Config, t tenant.Tenant) common.Config {
+	cfg := base
+	cfg.SenderMeshMailbox = t.MeshMailbox
+	cfg.SenderASID = t.ASID
+	cfg.DefaultSenderODS = t.DefaultSenderODS
+	if t.BusinessAckRequested != nil {
+		cfg.DefaultBusinessAckRequested = *t.BusinessAckRequested
+	}
+	if t.InfrastructureAckRequested != nil {
+		cfg.DefaultInfrastructureAckRequested = *t.InfrastructureAckRequested
+	}
+	if t.RecipientType != "" {
+		cfg.DefaultRecipientType = t.RecipientType
+	}
+	if t.IdentifierSystem != "" {
+		cfg.IdentifierSystem = t.IdentifierSystem
+	}
+	return cfg
+}
+
+// refreshODS re-reads the ODS extracts until ctx is done. A failed reload
+// keeps the previous data.
+func refreshODS(ctx context.Context, sites *ods.Directory, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := sites.Reload(); err != nil {
+				log.Printf("reload ODS data: %v", err)
+				continue
+			}
+			log.Printf("reloaded %d ODS records", sites.Len())
+		}
+	}
+}
+
 // --- helpers ---
 
+func correlate(w http.ResponseWriter, r *http.Request) {
+	if w.Header().Get("X-Correlation-ID") != "" {
+		return // already set for this request
+	}
+	corrID := r.Header.Get("X-Correlation-ID")
+	if corrID == "" {
+		corrID = uuid.New().String()
+	}
+	w.Header().Set("X-Correlation-ID", corrID)
+}
+
 func postOnly(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -189,15 +507,69 @@ func withJSON(h http.Handler) http.Handler {
 	})
 }
 
+type clientKey struct{}
+
+// withAuth requires a bearer token known to the tenant registry and records
+// the client on the request context and for the audit trail. It passes
+// everything through when no registry is configured.
+func withAuth(live *atomic.Pointer[settings], h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenants := live.Load().tenants
+		if tenants == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		clientID, ok := bearerClient(w, r, tenants, "")
+		if !ok {
+			return
+		}
+		noteAuditClient(r.Context(), clientID)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, clientID)))
+	})
+}
+
+// bearerClient authenticates the request's bearer token against reg,
+// answering 401 itself when it can't. A nil reg answers 403 with closed.
+func bearerClient(w http.ResponseWriter, r *http.Request, reg *tenant.Registry, closed string) (string, bool) {
+	if reg == nil {
+		writeErr(w, http.StatusForbidden, "FORBIDDEN", closed)
+		return "", false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="elevate-gpconnect"`)
+		writeErr(w, http.StatusUnauthorized, "UNAUTHORIZED", "bearer token required")
+		return "", false
+	}
+	clientID, ok := reg.Authenticate(strings.TrimSpace(token))
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="elevate-gpconnect", error="invalid_token"`)
+		writeErr(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid bearer token")
+		return "", false
+	}
+	return clientID, true
+}
+
+func clientFrom(ctx context.Context) string {
+	id, _ := ctx.Value(clientKey{}).(string)
+	return id
+}
+
 func writeErr(w http.ResponseWriter, status int, code, msg string) {
+	writeErrDetails(w, status, code, msg, nil)
+}
+
+func writeErrDetails(w http.ResponseWriter, status int, code, msg string, details map[string]any) {
+	e := map[string]any{
+		"code":    code,
+		"message": msg,
+	}
+	if details != nil {
+		e["details"] = details
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(map[string]any{
-		"error": map[string]any{
-			"code":    code,
-			"message": msg,
-		},
-	})
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": e})
 }
 
 func logMiddleware(next http.Handler) http.Handler {
@@ -207,10 +579,3 @@ func logMiddleware(next http.Handler) http.Handler {
 		log.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start).Round(time.Millisecond))
 	})
 }
-
-func getenv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return fallback
-}
@@ -0,0 +1,174 @@
+// Command audit-export verifies the gateway's audit log and writes the
+// entries a reviewer asks for as JSON lines or CSV.
+//
+//	audit-export [-file audit.jsonl] [-format jsonl|csv] [-from T] [-to T]
+//	             [-message ID] [-client ID] [-nhs NUMBER] [-out FILE]
+//
+// The log and NHS number key come from CONFIG_FILE (audit.file,
+// audit.nhsNumberKey) unless -file and AUDIT_NHS_NUMBER_KEY are given. The
+// chain state goes to stderr; the exit status is 1 on errors and 2 when the
+// chain is broken, after the entries have still been written.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/config"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/audit"
+)
+
+func main() {
+	log.SetFlags(0)
+	file := flag.String("file", "", "audit log (default: audit.file from CONFIG_FILE)")
+	format := flag.String("format", "jsonl", "output format: jsonl or csv")
+	fromS := flag.String("from", "", "only entries at or after this RFC 3339 time")
+	toS := flag.String("to", "", "only entries before this RFC 3339 time")
+	messageID := flag.String("message", "", "only entries for this message, including its amendments and retractions")
+	clientID := flag.String("client", "", "only entries for this client")
+	nhsNumber := flag.String("nhs", "", "only entries for this NHS number (needs the NHS number key)")
+	out := flag.String("out", "", "write here instead of stdout")
+	flag.Parse()
+
+	if *format != "jsonl" && *format != "csv" {
+		log.Fatalf("-format must be jsonl or csv")
+	}
+	from, err := parseTime("from", *fromS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	to, err := parseTime("to", *toS)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	path, key := *file, os.Getenv("AUDIT_NHS_NUMBER_KEY")
+	if path == "" || (*nhsNumber != "" && key == "") {
+		conf, err := config.Load(os.Getenv("CONFIG_FILE"))
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+		if path == "" {
+			path = conf.Audit.File
+		}
+		if key == "" {
+			key = conf.Audit.NHSNumberKey
+		}
+	}
+	if path == "" {
+		log.Fatal("no audit log: pass -file or set audit.file in CONFIG_FILE")
+	}
+	var nhsHash string
+	if *nhsNumber != "" {
+		if key == "" {
+			log.Fatal("-nhs needs the NHS number key (AUDIT_NHS_NUMBER_KEY or audit.nhsNumberKey)")
+		}
+		nhsHash = audit.HashNHSNumber([]byte(key), *nhsNumber)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	res, err := audit.Read(f, func(e audit.Entry) bool {
+		switch {
+		case *messageID != "" && e.MessageID != *messageID && e.RelatedID != *messageID:
+			return false
+		case *clientID != "" && e.ClientID != *clientID:
+			return false
+		case nhsHash != "" && e.NHSNumberHash != nhsHash:
+			return false
+		case !from.IsZero() && e.Time.Before(from):
+			return false
+		case !to.IsZero() && !e.Time.Before(to):
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		of, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer of.Close()
+		w = of
+	}
+	if *format == "csv" {
+		err = writeCSV(w, res.Entries)
+	} else {
+		err = writeJSONL(w, res.Entries)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("%s: %d entries, %d exported, head %s", path, res.Length, len(res.Entries), res.Head)
+	if err := res.Err(); err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+	log.Print("chain verified")
+}
+
+func parseTime(name, v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, errors.New("-" + name + " must be an RFC 3339 time")
+	}
+	return t, nil
+}
+
+func writeJSONL(w io.Writer, entries []audit.Entry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var csvHeader = []string{
+	"seq", "time", "event", "clientId", "correlationId", "action", "messageId", "messageType",
+	"relatedMessageId", "nhsNumberHash", "payloadHash", "fhirHash", "documentId", "meshMailbox",
+	"meshMessageId", "fromStatus", "toStatus", "httpStatus", "errorCode", "detail", "prevHash", "hash",
+}
+
+func writeCSV(w io.Writer, entries []audit.Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		status := ""
+		if e.HTTPStatus != 0 {
+			status = strconv.Itoa(e.HTTPStatus)
+		}
+		if err := cw.Write([]string{
+			strconv.FormatUint(e.Seq, 10), e.Time.Format(time.RFC3339Nano), e.Event, e.ClientID, e.CorrelationID,
+			e.Action, e.MessageID, e.MessageType, e.RelatedID, e.NHSNumberHash, e.PayloadHash, e.FHIRHash,
+			e.DocumentID, e.MeshMailbox, e.MeshMessageID, e.FromStatus, e.ToStatus, status, e.ErrorCode,
+			e.Detail, e.PrevHash, e.Hash,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
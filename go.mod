@@ -5,6 +5,7 @@ go 1.24.5
 require (
 	github.com/google/uuid v1.6.0
 	github.com/oapi-codegen/runtime v1.1.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/apapsch/go-jsonmerge/v2 v2.0.0 // indirect
@@ -0,0 +1,373 @@
+// Package config loads the gateway's settings from a YAML or JSON file,
+// applies environment overrides and validates the result.
+//
+// Settings are split into structural ones (server, storage, reference data
+// files, audit log), which need a restart to change, and the rest (MESH
+// sender, routing defaults, feature flags, identifier system, duplicate
+// checks, tenants, audit reviewers), which can be reloaded on SIGHUP.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/dedup"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/tenant"
+)
+
+type Config struct {
+	Server      Server      `yaml:"server"`
+	MESH        MESH        `yaml:"mesh"`
+	Routing     Routing     `yaml:"routing"`
+	Storage     Storage     `yaml:"storage"`
+	Data        Data        `yaml:"data"`
+	Features    Features    `yaml:"features"`
+	Identifiers Identifiers `yaml:"identifiers"`
+	Duplicates  Duplicates  `yaml:"duplicates"`
+	Tenants     Tenants     `yaml:"tenants"`
+	Audit       Audit       `yaml:"audit"`
+}
+
+// Server holds the HTTP listener settings. Durations are Go duration
+// strings such as "15s".
+type Server struct {
+	Addr              string        `yaml:"addr"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout"`
+	MaxBodyBytes      int64         `yaml:"maxBodyBytes"`
+}
+
+// MESH is the single sender used when no tenants are configured.
+type MESH struct {
+	Mailbox string `yaml:"mailbox"`
+	ASID    string `yaml:"asid"`
+}
+
+// Routing holds the message defaults used when a request or tenant doesn't
+// set them.
+type Routing struct {
+	DefaultSenderODS           string `yaml:"defaultSenderODS"`
+	BusinessAckRequested       bool   `yaml:"businessAckRequested"`
+	InfrastructureAckRequested bool   `yaml:"infrastructureAckRequested"`
+	RecipientType              string `yaml:"recipientType"`
+}
+
+// Storage configures where idempotency and message records are kept. Only the
+// in-process "memory" driver exists today.
+type Storage struct {
+	Driver         string        `yaml:"driver"`
+	IdempotencyTTL time.Duration `yaml:"idempotencyTTL"` // 0 keeps records for the process lifetime
+}
+
+// Data lists the local reference data extracts.
+type Data struct {
+	ODSFiles           []string      `yaml:"odsFiles"`
+	ODSRefreshInterval time.Duration `yaml:"odsRefreshInterval"` // 0 disables refresh
+	DMDFiles           []string      `yaml:"dmdFiles"`
+}
+
+type Features struct {
+	// DeriveInterpretation flags known vitals the sender left unflagged. Off
+	// by default: it adds clinical interpretations the sender didn't make.
+	DeriveInterpretation bool `yaml:"deriveInterpretation"`
+}
+
+// Identifiers sets the base of the provider identifier systems that client
+// source IDs are issued under, e.g. https://pmr.example/identifier. Tenants
+// can override it.
+type Identifiers struct {
+	System string `yaml:"system"`
+}
+
+// Duplicates configures content-level duplicate detection: what happens to
+// a message whose patient, encounter time, record type and clinical entries
+// match one the same client sent within the window.
+type Duplicates struct {
+	Action string        `yaml:"action"` // reject, flag or off
+	Window time.Duration `yaml:"window"`
+}
+
+// Tenants is either a path to a tenant registry file or the registry inline.
+type Tenants struct {
+	File    string          `yaml:"file"`
+	Clients []tenant.Client `yaml:"clients"`
+	Tenants []tenant.Tenant `yaml:"tenants"`
+}
+
+// Configured reports whether any tenants are set up.
+func (t Tenants) Configured() bool {
+	return t.File != "" || len(t.Clients) > 0 || len(t.Tenants) > 0
+}
+
+// Registry loads the tenant registry, or returns nil when none is configured.
+func (t Tenants) Registry() (*tenant.Registry, error) {
+	switch {
+	case t.File != "" && (len(t.Clients) > 0 || len(t.Tenants) > 0):
+		return nil, errors.New("tenants: set either file or inline clients/tenants, not both")
+	case t.File != "":
+		return tenant.LoadFile(t.File)
+	case len(t.Clients) > 0 || len(t.Tenants) > 0:
+		return tenant.New(tenant.File{Clients: t.Clients, Tenants: t.Tenants})
+	}
+	return nil, nil
+}
+
+// Audit configures the audit log. Without a file entries are kept in
+// memory and lost on restart. The file and key need a restart to change;
+// reviewers are reloaded.
+type Audit struct {
+	File         string          `yaml:"file"`
+	NHSNumberKey string          `yaml:"nhsNumberKey"` // HMAC key for NHS number hashes; required with a file
+	Reviewers    []tenant.Client `yaml:"reviewers"`    // bearer tokens allowed to read the log
+}
+
+// ReviewerRegistry authenticates audit reviewers, or is nil when none are
+// configured and the audit API is closed.
+func (a Audit) ReviewerRegistry() (*tenant.Registry, error) {
+	if len(a.Reviewers) == 0 {
+		return nil, nil
+	}
+	return tenant.New(tenant.File{Clients: a.Reviewers})
+}
+
+// Default returns the settings used for anything the file and environment
+// leave unset.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8084",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   10 * time.Second,
+			MaxBodyBytes:      5 << 20,
+		},
+		Routing: Routing{
+			BusinessAckRequested:       true,
+			InfrastructureAckRequested: true,
+			RecipientType:              "FI",
+		},
+		Storage:    Storage{Driver: "memory"},
+		Data:       Data{ODSRefreshInterval: 24 * time.Hour},
+		Duplicates: Duplicates{Action: dedup.Reject, Window: 24 * time.Hour},
+	}
+}
+
+// Load reads path (when not empty) over the defaults, applies environment
+// overrides and validates the result. Unknown keys in the file are errors.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// YAML is a superset of JSON, so one decoder reads both
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// envOverrides maps environment variables onto settings. The names predate
+// the config file and are kept so existing deployments keep working.
+var envOverrides = []struct {
+	Name string
+	Set  func(c *Config, v string) error
+}{
+	{"PORT", func(c *Config, v string) error { c.Server.Addr = v; return nil }},
+	{"MAX_BODY_BYTES", func(c *Config, v string) (err error) {
+		c.Server.MaxBodyBytes, err = strconv.ParseInt(v, 10, 64)
+		return
+	}},
+	{"SENDER_MESH_MAILBOX_ID", func(c *Config, v string) error { c.MESH.Mailbox = v; return nil }},
+	{"SENDER_ASID", func(c *Config, v string) error { c.MESH.ASID = v; return nil }},
+	{"DEFAULT_SENDER_ODS", func(c *Config, v string) error { c.Routing.DefaultSenderODS = v; return nil }},
+	{"DEFAULT_RECIPIENT_TYPE", func(c *Config, v string) error { c.Routing.RecipientType = v; return nil }},
+	{"DERIVE_INTERPRETATION", func(c *Config, v string) (err error) {
+		c.Features.DeriveInterpretation, err = strconv.ParseBool(v)
+		return
+	}},
+	{"ODS_DATA_FILES", func(c *Config, v string) error { c.Data.ODSFiles = splitList(v); return nil }},
+	{"ODS_REFRESH_INTERVAL", func(c *Config, v string) (err error) {
+		c.Data.ODSRefreshInterval, err = time.ParseDuration(v)
+		return
+	}},
+	{"DMD_DATA_FILES", func(c *Config, v string) error { c.Data.DMDFiles = splitList(v); return nil }},
+	{"IDENTIFIER_SYSTEM", func(c *Config, v string) error { c.Identifiers.System = v; return nil }},
+	{"DUPLICATE_ACTION", func(c *Config, v string) error { c.Duplicates.Action = v; return nil }},
+	{"DUPLICATE_WINDOW", func(c *Config, v string) (err error) {
+		c.Duplicates.Window, err = time.ParseDuration(v)
+		return
+	}},
+	{"TENANTS_FILE", func(c *Config, v string) error { c.Tenants.File = v; return nil }},
+	{"AUDIT_FILE", func(c *Config, v string) error { c.Audit.File = v; return nil }},
+	{"AUDIT_NHS_NUMBER_KEY", func(c *Config, v string) error { c.Audit.NHSNumberKey = v; return nil }},
+}
+
+func applyEnv(c *Config, lookup func(string) (string, bool)) error {
+	var problems []string
+	for _, o := range envOverrides {
+		v, ok := lookup(o.Name)
+		if !ok || v == "" {
+			continue
+		}
+		if err := o.Set(c, v); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", o.Name, err))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+var asidPattern = regexp.MustCompile(`^\d{12}$`)
+
+// Validate reports every problem with the settings, not just the first.
+func (c Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...any) { problems = append(problems, fmt.Sprintf(format, args...)) }
+
+	if strings.TrimSpace(c.Server.Addr) == "" {
+		add("server.addr is required")
+	}
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"readHeaderTimeout", c.Server.ReadHeaderTimeout},
+		{"readTimeout", c.Server.ReadTimeout},
+		{"writeTimeout", c.Server.WriteTimeout},
+		{"idleTimeout", c.Server.IdleTimeout},
+		{"shutdownTimeout", c.Server.ShutdownTimeout},
+	} {
+		if t.d <= 0 {
+			add("server.%s must be positive", t.name)
+		}
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		add("server.maxBodyBytes must be positive")
+	}
+
+	if !c.Tenants.Configured() && strings.TrimSpace(c.MESH.Mailbox) == "" {
+		add("mesh.mailbox is required when no tenants are configured")
+	}
+	if c.MESH.ASID != "" && !asidPattern.MatchString(c.MESH.ASID) {
+		add("mesh.asid %q must be 12 digits", c.MESH.ASID)
+	}
+	if strings.TrimSpace(c.Routing.RecipientType) == "" {
+		add("routing.recipientType is required")
+	}
+
+	if s := c.Identifiers.System; s != "" && !isSystemURL(s) {
+		add("identifiers.system %q must be an absolute http(s) URL", s)
+	}
+
+	switch c.Duplicates.Action {
+	case dedup.Reject, dedup.Flag, dedup.Off:
+	default:
+		add("duplicates.action %q must be reject, flag or off", c.Duplicates.Action)
+	}
+	if c.Duplicates.Action != dedup.Off && c.Duplicates.Window <= 0 {
+		add("duplicates.window must be positive")
+	}
+
+	if c.Storage.Driver != "memory" {
+		add("storage.driver %q must be memory", c.Storage.Driver)
+	}
+	if c.Storage.IdempotencyTTL < 0 {
+		add("storage.idempotencyTTL must not be negative")
+	}
+
+	if c.Data.ODSRefreshInterval < 0 {
+		add("data.odsRefreshInterval must not be negative")
+	}
+	for i, f := range c.Data.ODSFiles {
+		if _, err := os.Stat(f); err != nil {
+			add("data.odsFiles[%d]: %v", i, err)
+		}
+	}
+	for i, f := range c.Data.DMDFiles {
+		if _, err := os.Stat(f); err != nil {
+			add("data.dmdFiles[%d]: %v", i, err)
+		}
+	}
+
+	if _, err := c.Tenants.Registry(); err != nil {
+		add("tenants: %v", err)
+	}
+
+	// a short or missing key would let NHS numbers be recovered by trying them all
+	if c.Audit.File != "" && len(c.Audit.NHSNumberKey) < 32 {
+		add("audit.nhsNumberKey of at least 32 characters is required with audit.file")
+	}
+	if _, err := c.Audit.ReviewerRegistry(); err != nil {
+		add("audit.reviewers: %v", strings.ReplaceAll(err.Error(), "clients[", "reviewers["))
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// isSystemURL reports whether s can be used as an identifier system: an
+// absolute http or https URL.
+func isSystemURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// StructuralChanges lists the settings that differ from prev but only take
+// effect after a restart.
+func (c Config) StructuralChanges(prev Config) []string {
+	var changed []string
+	if !reflect.DeepEqual(c.Server, prev.Server) {
+		changed = append(changed, "server")
+	}
+	if !reflect.DeepEqual(c.Storage, prev.Storage) {
+		changed = append(changed, "storage")
+	}
+	if !reflect.DeepEqual(c.Data, prev.Data) {
+		changed = append(changed, "data")
+	}
+	if c.Audit.File != prev.Audit.File || c.Audit.NHSNumberKey != prev.Audit.NHSNumberKey {
+		changed = append(changed, "audit")
+	}
+	return changed
+}
@@ -0,0 +1,244 @@
+// Package audit keeps an append-only log of what each client sent, what it
+// was built into and how its status changed. Every entry carries the hash
+// of the one before it, so editing, removing or reordering entries breaks
+// the chain and Read reports where. Cutting entries off the end only shows
+// against a head hash noted earlier, which queries and exports report.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events.
+const (
+	Received = "received" // request arrived
+	Rejected = "rejected" // refused: validation, authorisation, duplicate...
+	Built    = "built"    // FHIR message assembled
+	Replayed = "replayed" // Idempotency-Key matched; earlier response returned
+	Status   = "status"   // a message's status changed
+	Queried  = "queried"  // a reviewer read the audit log
+)
+
+// Entry is one audit record. Hashes are hex SHA-256; the NHS number is
+// keyed (HMAC) so it can be matched but not recovered from the log.
+type Entry struct {
+	Seq           uint64    `json:"seq"`
+	Time          time.Time `json:"time"`
+	Event         string    `json:"event"`
+	ClientID      string    `json:"clientId,omitempty"`
+	CorrelationID string    `json:"correlationId,omitempty"`
+	Action        string    `json:"action,omitempty"` // submit, amend, retract
+	MessageID     string    `json:"messageId,omitempty"`
+	MessageType   string    `json:"messageType,omitempty"`
+	RelatedID     string    `json:"relatedMessageId,omitempty"` // message amended, retracted or duplicated
+	NHSNumberHash string    `json:"nhsNumberHash,omitempty"`
+	PayloadHash   string    `json:"payloadHash,omitempty"`
+	FHIRHash      string    `json:"fhirHash,omitempty"`
+	DocumentID    string    `json:"documentId,omitempty"`
+	MeshMailbox   string    `json:"meshMailbox,omitempty"`
+	MeshMessageID string    `json:"meshMessageId,omitempty"` // empty until MESH delivery exists
+	FromStatus    string    `json:"fromStatus,omitempty"`
+	ToStatus      string    `json:"toStatus,omitempty"`
+	HTTPStatus    int       `json:"httpStatus,omitempty"`
+	ErrorCode     string    `json:"errorCode,omitempty"`
+	Detail        string    `json:"detail,omitempty"`
+	PrevHash      string    `json:"prevHash"`
+	Hash          string    `json:"hash"`
+}
+
+// genesis is the PrevHash of the first entry.
+var genesis = strings.Repeat("0", 64)
+
+// chainHash is an entry's hash: SHA-256 over the previous hash and the
+// entry's JSON with Hash empty.
+func chainHash(e Entry) string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	sum := sha256.Sum256(append([]byte(e.PrevHash+"\n"), b...))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashNHSNumber keys an NHS number for the log. The same key must be used
+// to look a patient up later.
+func HashNHSNumber(key []byte, nhsNumber string) string {
+	nhs := strings.ReplaceAll(strings.TrimSpace(nhsNumber), " ", "")
+	if nhs == "" {
+		return ""
+	}
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(nhs))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Hash is the hex SHA-256 of b, for payload and FHIR hashes.
+func Hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+/* ---- Log ---- */
+
+// Log appends entries as JSON lines, to a file or, without one, to memory
+// for the process lifetime.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	mem  bytes.Buffer
+	seq  uint64
+	head string
+}
+
+// Open opens the log at path, verifying the entries already there and
+// continuing their chain. An empty path keeps the log in memory.
+func Open(path string) (*Log, error) {
+	l := &Log{path: path, head: genesis}
+	if path == "" {
+		return l, nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	res, err := Read(f, nil)
+	if err == nil && !res.Verified {
+		err = res.Err()
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	l.f, l.seq, l.head = f, res.Length, res.Head
+	return l, nil
+}
+
+func (l *Log) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// Append chains e onto the log and writes it through before returning.
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.Seq = l.seq + 1
+	e.PrevHash = l.head
+	e.Hash = chainHash(e)
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	line = append(line, '\n')
+	if l.f == nil {
+		l.mem.Write(line)
+	} else {
+		if _, err := l.f.Write(line); err != nil {
+			return Entry{}, err
+		}
+		if err := l.f.Sync(); err != nil {
+			return Entry{}, err
+		}
+	}
+	l.seq, l.head = e.Seq, e.Hash
+	return e, nil
+}
+
+// Query reads the whole log, verifying it, and returns the entries match
+// selects (all of them when match is nil).
+func (l *Log) Query(match func(Entry) bool) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return Read(bytes.NewReader(l.mem.Bytes()), match)
+	}
+	f, err := os.Open(l.path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+	return Read(f, match)
+}
+
+/* ---- Reading & verification ---- */
+
+// Result is what Read found: the selected entries and the state of the chain.
+type Result struct {
+	Entries  []Entry
+	Length   uint64 // entries read
+	Head     string // hash of the last entry
+	Verified bool
+	BrokenAt uint64 // line where the chain first breaks, when not verified
+	Problem  string
+}
+
+// Err describes a broken chain, or is nil.
+func (r Result) Err() error {
+	if r.Verified {
+		return nil
+	}
+	return fmt.Errorf("audit chain broken at line %d: %s", r.BrokenAt, r.Problem)
+}
+
+// Read walks a log, checking each entry follows the one before, and keeps
+// the entries match selects. It stops checking at the first break but still
+// reads the rest, so reviewers can see what follows.
+func Read(r io.Reader, match func(Entry) bool) (Result, error) {
+	res := Result{Head: genesis, Verified: true}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	var line uint64
+	for sc.Scan() {
+		line++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			res.breaks(line, fmt.Sprintf("unreadable entry: %v", err))
+			continue
+		}
+		if res.Verified {
+			switch {
+			case e.Seq != res.Length+1:
+				res.breaks(line, fmt.Sprintf("seq %d, expected %d", e.Seq, res.Length+1))
+			case e.PrevHash != res.Head:
+				res.breaks(line, fmt.Sprintf("seq %d prevHash doesn't match the previous entry", e.Seq))
+			case chainHash(e) != e.Hash:
+				res.breaks(line, fmt.Sprintf("seq %d hash doesn't match its content", e.Seq))
+			}
+		}
+		res.Length++
+		res.Head = e.Hash
+		if match == nil || match(e) {
+			res.Entries = append(res.Entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func (r *Result) breaks(line uint64, problem string) {
+	if !r.Verified {
+		return
+	}
+	r.Verified, r.BrokenAt, r.Problem = false, line, problem
+}
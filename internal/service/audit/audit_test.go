@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chain appends n entries for client to an in-memory log and returns its
+// lines and head.
+func chain(t *testing.T, client string, n int) ([]string, string) {
+	t.Helper()
+	l, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var head string
+	for i := 0; i < n; i++ {
+		e, err := l.Append(Entry{Event: Received, ClientID: client, Detail: strings.Repeat("x", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		head = e.Hash
+	}
+	return strings.Split(strings.TrimSuffix(l.mem.String(), "\n"), "\n"), head
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(lines []string) []string
+		verified bool
+		brokenAt uint64
+		problem  string
+		length   uint64
+	}{
+		{"intact", func(lines []string) []string { return lines }, true, 0, "", 4},
+		{"entry edited", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"tenant-a"`, `"tenant-b"`, 1)
+			return lines
+		}, false, 2, "seq 2 hash doesn't match its content", 4},
+		{"entries reordered", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, false, 2, "seq 3, expected 2", 4},
+		{"entry removed", func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, false, 2, "seq 3, expected 2", 3},
+		{"entry from another chain", func(lines []string) []string {
+			other, _ := chain(t, "tenant-b", 4)
+			lines[2] = other[2]
+			return lines
+		}, false, 3, "seq 3 prevHash doesn't match the previous entry", 4},
+		{"unreadable entry", func(lines []string) []string {
+			lines[3] = "{"
+			return lines
+		}, false, 4, "unreadable entry", 3},
+		// only a head noted earlier shows this; see TestReadTruncated
+		{"last entry cut off", func(lines []string) []string { return lines[:3] }, true, 0, "", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, _ := chain(t, "tenant-a", 4)
+			lines = tt.edit(lines)
+			res, err := Read(strings.NewReader(strings.Join(lines, "\n")+"\n"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Verified != tt.verified || res.BrokenAt != tt.brokenAt || !strings.HasPrefix(res.Problem, tt.problem) {
+				t.Errorf("got verified %v, broken at %d (%s); want %v, %d (%s)", res.Verified, res.BrokenAt, res.Problem, tt.verified, tt.brokenAt, tt.problem)
+			}
+			if res.Length != tt.length {
+				t.Errorf("read %d entries, want %d", res.Length, tt.length)
+			}
+			if len(res.Entries) != int(tt.length) {
+				t.Errorf("kept %d entries, want every one read, after a break too", len(res.Entries))
+			}
+		})
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	lines, head := chain(t, "tenant-a", 4)
+	res, err := Read(strings.NewReader(strings.Join(lines[:3], "\n")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Head == head {
+		t.Errorf("head %s after cutting off the last entry, still the head noted before", res.Head)
+	}
+}
+
+func TestOpenRefusesBrokenChain(t *testing.T) {
+	lines, _ := chain(t, "tenant-a", 3)
+	lines[0] = strings.Replace(lines[0], `"received"`, `"rejected"`, 1)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("got %v, want the broken chain refused at line 1", err)
+	}
+}
+
+func TestOpenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i := 0; i < 2; i++ {
+		l, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Append(Entry{Event: Received}); err != nil {
+			t.Fatal(err)
+		}
+		l.Close()
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Read(bytes.NewReader(b), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Verified || res.Length != 2 {
+		t.Errorf("got %d entries, verified %v (%s); want 2, verified", res.Length, res.Verified, res.Problem)
+	}
+}
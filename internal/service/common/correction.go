@@ -0,0 +1,211 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ---- Amendments & entered-in-error ---- */
+
+// Composition statuses a correction can set.
+const (
+	CorrectionAmended        = "amended"
+	CorrectionEnteredInError = "entered-in-error"
+)
+
+// Correction rebuilds a message that was already sent. An amendment carries
+// corrected content; an entered-in-error message retracts the original and
+// marks every clinical resource in it entered-in-error.
+type Correction struct {
+	Status           string            // CorrectionAmended or CorrectionEnteredInError
+	Reason           string            // shown in the Composition narrative
+	ReplacesDocument string            // document Bundle fullUrl of the message being corrected
+	ResourceIDs      map[string]string // BuildResult.ResourceIDs of the message being corrected
+	Original         any               // request of the message being corrected, as Decode returned it
+}
+
+// CorrectUpdateRecord builds an Update Record that amends or retracts an
+// earlier one. Resources matched to the original, by source ID or the
+// client's id, keep their IDs; an amendment sends the original's clinical
+// resources it no longer has as entered-in-error.
+func CorrectUpdateRecord(req http.UpdateRecordRequest, cfg Config, c Correction) (*BuildResult, error) {
+	if orig, ok := c.Original.(http.UpdateRecordRequest); ok && c.Status == CorrectionAmended {
+		if err := sameParties(req, orig, cfg.DefaultSenderODS); err != nil {
+			return nil, err
+		}
+	}
+	return buildUpdateRecord(updateRecord, req, cfg, &c)
+}
+
+// ErrCorrectionMismatch is returned for an amendment about a different
+// patient, practice or sender from the message it amends.
+var ErrCorrectionMismatch = errors.New("an amendment must be for the same patient, registered practice and sender as the original")
+
+// sameParties checks an amendment is about the patient the original was, for
+// the same practice and from the same sender. Its resources reuse the
+// original's IDs, so anything else would rewrite someone else's record.
+func sameParties(req, orig http.UpdateRecordRequest, defaultSender string) error {
+	sender := func(r http.UpdateRecordRequest) string {
+		if ods := SenderODS(r); ods != "" {
+			return strings.ToUpper(ods)
+		}
+		return strings.ToUpper(strings.TrimSpace(defaultSender))
+	}
+	var problems []string
+	// NHS numbers stay out of the message, which ends up in the audit log
+	if nhsNumberKey(req.Patient.NhsNumber) != nhsNumberKey(orig.Patient.NhsNumber) {
+		problems = append(problems, "patient.nhsNumber differs from the original")
+	}
+	for _, f := range []struct {
+		field    string
+		got, was string
+	}{
+		{"routing.registeredPracticeODS", strings.ToUpper(strings.TrimSpace(req.Routing.RegisteredPracticeODS)), strings.ToUpper(strings.TrimSpace(orig.Routing.RegisteredPracticeODS))},
+		{"sender ODS", sender(req), sender(orig)},
+	} {
+		if f.got != f.was {
+			problems = append(problems, fmt.Sprintf("%s is %q, was %q", f.field, f.got, f.was))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrCorrectionMismatch, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func nhsNumberKey(s string) string {
+	return strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+}
+
+// resourceIDs allocates the fullUrl for each resource by a key naming it
+// within the message, such as "patient", "observation|<sourceId>" or
+// "procedure/<id>". Keys found in reuse get their earlier ID, so a
+// corrected resource keeps its identity.
+type resourceIDs struct {
+	reuse       map[string]string
+	sameRequest bool // reuse is from this very request, so positions match too
+	assigned    map[string]string
+}
+
+func newResourceIDs(reuse map[string]string, sameRequest bool) *resourceIDs {
+	return &resourceIDs{reuse: reuse, sameRequest: sameRequest, assigned: map[string]string{}}
+}
+
+func (r *resourceIDs) id(key string) string {
+	if id, ok := r.assigned[key]; ok {
+		return id
+	}
+	id, ok := r.reuse[key]
+	if !ok {
+		id = newURN()
+	}
+	r.assigned[key] = id
+	return id
+}
+
+// byPosition is id for a resource known only by its place in the request,
+// which says nothing about which resource it was in a different request.
+func (r *resourceIDs) byPosition(key string) string {
+	if _, ok := r.assigned[key]; !ok && !r.sameRequest {
+		r.assigned[key] = newURN()
+	}
+	return r.id(key)
+}
+
+// derived is id for a resource whose ID follows from its identifier; a
+// correction still keeps the original's ID.
+func (r *resourceIDs) derived(key, name string) string {
+	if id, ok := r.assigned[key]; ok {
+		return id
+	}
+	id, ok := r.reuse[key]
+	if !ok {
+		id = nameBasedURN(name)
+	}
+	r.assigned[key] = id
+	return id
+}
+
+// droppedEntry is a resource of the message being amended that the
+// amendment no longer has, with the heading it was filed under.
+type droppedEntry struct {
+	Entry
+	heading string
+}
+
+// droppedEntries rebuilds the message being amended as a retraction and
+// returns the resources the amendment no longer has: clinical ones marked
+// entered-in-error, along with the practitioners, organisations and
+// encounters they refer to, so every reference in the bundle resolves.
+func droppedEntries(c *Correction, cfg Config, kept []Entry) ([]droppedEntry, error) {
+	orig, ok := c.Original.(http.UpdateRecordRequest)
+	if !ok {
+		return nil, nil
+	}
+	prev, err := buildUpdateRecord(updateRecord, orig, cfg, &Correction{
+		Status:           CorrectionEnteredInError,
+		ReplacesDocument: c.ReplacesDocument,
+		ResourceIDs:      c.ResourceIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rebuild the original to retract what the amendment leaves out: %w", err)
+	}
+	have := map[string]bool{}
+	for _, e := range kept {
+		have[e.FullURL] = true
+	}
+	var out []droppedEntry
+	for _, e := range prev.entries {
+		if !have[e.FullURL] {
+			out = append(out, droppedEntry{Entry: e, heading: prev.filed[e.FullURL]})
+		}
+	}
+	return out, nil
+}
+
+type CompositionRelatesTo struct {
+	Code             Text `xml:"code"`
+	TargetIdentifier struct {
+		System Attr `xml:"system"`
+		Value  Attr `xml:"value"`
+	} `xml:"targetIdentifier"`
+}
+
+// applyCorrection sets the Composition status and points it at the document
+// it replaces, by that document Bundle's identifier.
+func applyCorrection(comp *Composition, c Correction) {
+	comp.Status = Text{Value: c.Status}
+	rel := CompositionRelatesTo{Code: Text{Value: "replaces"}}
+	rel.TargetIdentifier.System = Attr{Value: bundleIdentifierSystem}
+	rel.TargetIdentifier.Value = Attr{Value: trimURN(c.ReplacesDocument)}
+	comp.RelatesTo = []CompositionRelatesTo{rel}
+}
+
+// markEnteredInError sets entered-in-error on every clinical resource in a
+// retraction. Patient, Practitioner, Organization, Location and Device
+// describe who and where, not what happened, so keep their details.
+func markEnteredInError(entries []Entry) {
+	eie := Text{Value: CorrectionEnteredInError}
+	for _, e := range entries {
+		r := e.Resource
+		switch {
+		case r.Encounter != nil:
+			r.Encounter.Status = eie
+		case r.Observation != nil:
+			r.Observation.Status = eie
+		case r.Procedure != nil:
+			r.Procedure.Status = eie
+		case r.Immunization != nil:
+			r.Immunization.Status = eie
+		case r.ReferralRequest != nil:
+			r.ReferralRequest.Status = eie
+		case r.MedicationDispense != nil:
+			r.MedicationDispense.Status = eie
+		case r.ClinicalImpression != nil:
+			r.ClinicalImpression.Status = eie
+		}
+	}
+}
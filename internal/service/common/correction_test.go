@@ -0,0 +1,250 @@
+package common
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/ods"
+)
+
+const correctionRequest = `{
+	"patient": {"nhsNumber": "9876543210", "dateOfBirth": "1990-02-17", "surname": "SMITH"},
+	"clinicalSummary": {"freeText": "Sore throat"},
+	"composition": {"title": "Pharmacy consultation", "type": {"system": "http://snomed.info/sct", "code": "1659111000000107", "display": "Community pharmacy service"}},
+	"encounter": {"occurredAt": "2024-05-01T10:15:00+01:00"},
+	"provenance": {"author": {"name": "Miss Di Spencer"}, "system": {"name": "PMR", "asid": "200000000115"}},
+	"routing": {"registeredPracticeODS": "G85001"},
+	"observations": [
+		{"id": "a", "status": "final", "code": {"system": "http://snomed.info/sct", "code": "1000001", "display": "A"}, "effectiveDateTime": "2024-05-01T10:15:00+01:00", "valueString": "a"},
+		{"id": "b", "status": "final", "code": {"system": "http://snomed.info/sct", "code": "1000002", "display": "B"}, "effectiveDateTime": "2024-05-01T10:15:00+01:00", "valueString": "b"},
+		{"sourceId": "obs-3", "status": "final", "code": {"system": "http://snomed.info/sct", "code": "1000003", "display": "C"}, "effectiveDateTime": "2024-05-01T10:15:00+01:00", "valueString": "c"},
+		{"status": "final", "code": {"system": "http://snomed.info/sct", "code": "1000004", "display": "D"}, "effectiveDateTime": "2024-05-01T10:15:00+01:00", "valueString": "d"}
+	]
+}`
+
+// sentObservation is what a message says about one observation.
+type sentObservation struct {
+	code, status string
+}
+
+// sentObservations reads the observations out of a built message by fullUrl.
+func sentObservations(t *testing.T, msg []byte) map[string]sentObservation {
+	t.Helper()
+	type value struct {
+		Value string `xml:"value,attr"`
+	}
+	type bundle struct {
+		Entry []struct {
+			FullURL  string `xml:"fullUrl"`
+			Resource struct {
+				Bundle      *bundle `xml:"Bundle"`
+				Observation *struct {
+					Status value `xml:"status"`
+					Code   struct {
+						Coding []struct {
+							Code value `xml:"code"`
+						} `xml:"coding"`
+					} `xml:"code"`
+				} `xml:"Observation"`
+			} `xml:"resource"`
+		} `xml:"entry"`
+	}
+	var b bundle
+	if err := xml.Unmarshal(msg, &b); err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]sentObservation{}
+	for _, e := range b.Entry {
+		if e.Resource.Bundle == nil {
+			continue
+		}
+		for _, d := range e.Resource.Bundle.Entry {
+			if ob := d.Resource.Observation; ob != nil {
+				out[d.FullURL] = sentObservation{code: ob.Code.Coding[0].Code.Value, status: ob.Status.Value}
+			}
+		}
+	}
+	return out
+}
+
+func TestAmendmentKeepsIDsByIdentity(t *testing.T) {
+	cfg := Config{SenderMeshMailbox: "MBX", DefaultSenderODS: "FA123", DefaultRecipientType: "FI"}
+	var req http.UpdateRecordRequest
+	if err := json.Unmarshal([]byte(correctionRequest), &req); err != nil {
+		t.Fatal(err)
+	}
+	orig, err := BuildUpdateRecord(req, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := sentObservations(t, orig.XML)
+
+	tests := []struct {
+		name     string
+		keep     []int  // original observations, in their new order
+		retained []bool // by original position: expected to keep its ID
+	}{
+		{"reordered", []int{2, 1, 0}, []bool{true, true, true, false}},
+		{"shortened", []int{2, 1}, []bool{false, true, true, false}},
+		{"reordered and shortened", []int{3, 0}, []bool{true, false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amended := req
+			obs := make([]http.ObservationInput, 0, len(tt.keep))
+			for _, i := range tt.keep {
+				obs = append(obs, (*req.Observations)[i])
+			}
+			amended.Observations = &obs
+
+			res, err := CorrectUpdateRecord(amended, cfg, Correction{
+				Status:           CorrectionAmended,
+				ReplacesDocument: orig.DocumentID,
+				ResourceIDs:      orig.ResourceIDs,
+				Original:         req,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := sentObservations(t, res.XML)
+
+			// every ID still names the fact it named before
+			for url, ob := range after {
+				if was, ok := before[url]; ok && was.code != ob.code {
+					t.Errorf("%s was code %s, now %s", url, was.code, ob.code)
+				}
+			}
+			for url, was := range before {
+				ob, ok := after[url]
+				if !ok {
+					t.Errorf("%s (code %s) is missing from the amendment", url, was.code)
+					continue
+				}
+				i := int(was.code[len(was.code)-1] - '1')
+				want := "final"
+				if !tt.retained[i] {
+					want = CorrectionEnteredInError
+				}
+				if ob.status != want {
+					t.Errorf("%s (code %s) status %s, want %s", url, was.code, ob.status, want)
+				}
+			}
+			// kept observations that couldn't be matched are sent afresh
+			if want := len(before) + len(tt.keep) - countTrue(tt.retained); len(after) != want {
+				t.Errorf("amendment has %d observations, want %d", len(after), want)
+			}
+		})
+	}
+}
+
+func TestRetractionKeepsEveryID(t *testing.T) {
+	cfg := Config{SenderMeshMailbox: "MBX", DefaultSenderODS: "FA123", DefaultRecipientType: "FI"}
+	var req http.UpdateRecordRequest
+	if err := json.Unmarshal([]byte(correctionRequest), &req); err != nil {
+		t.Fatal(err)
+	}
+	orig, err := BuildUpdateRecord(req, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := CorrectUpdateRecord(req, cfg, Correction{
+		Status:           CorrectionEnteredInError,
+		ReplacesDocument: orig.DocumentID,
+		ResourceIDs:      orig.ResourceIDs,
+		Original:         req,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, after := sentObservations(t, orig.XML), sentObservations(t, res.XML)
+	if len(after) != len(before) {
+		t.Errorf("retraction has %d observations, want %d", len(after), len(before))
+	}
+	for url, was := range before {
+		if ob := after[url]; ob.code != was.code || ob.status != CorrectionEnteredInError {
+			t.Errorf("%s: got %+v, want code %s entered-in-error", url, ob, was.code)
+		}
+	}
+}
+
+func TestRetractionSkipsReferenceData(t *testing.T) {
+	cfg := Config{SenderMeshMailbox: "MBX", DefaultSenderODS: "FA123", DefaultRecipientType: "FI"}
+	var req http.UpdateRecordRequest
+	if err := json.Unmarshal([]byte(correctionRequest), &req); err != nil {
+		t.Fatal(err)
+	}
+	orig, err := BuildUpdateRecord(req, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// since it was sent, the registered practice has gone from ODS
+	cfg.Sites, err = ods.LoadCSV(strings.NewReader(`"FA123","HIGH STREET PHARMACY","Y56","QMJ","12 HIGH STREET","","","LONDON","GREATER LONDON","N1 1AA","20100401","","A","4","","","","02071234567"` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Correction{ReplacesDocument: orig.DocumentID, ResourceIDs: orig.ResourceIDs, Original: req}
+	c.Status = CorrectionAmended
+	if _, err := CorrectUpdateRecord(req, cfg, c); err == nil || !strings.Contains(err.Error(), "G85001") {
+		t.Errorf("amendment: got %v, want the unknown practice rejected", err)
+	}
+	c.Status = CorrectionEnteredInError
+	if _, err := CorrectUpdateRecord(req, cfg, c); err != nil {
+		t.Errorf("retraction: %v", err)
+	}
+}
+
+func countTrue(bs []bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+func TestAmendmentKeepsParties(t *testing.T) {
+	orig := testRequest(t, nil)
+	sent, err := BuildUpdateRecord(orig, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		change func(req *http.UpdateRecordRequest)
+		field  string // "" when the amendment should go through
+	}{
+		{"unchanged but spaced", func(req *http.UpdateRecordRequest) { req.Patient.NhsNumber = "987 654 3210" }, ""},
+		{"sender named as the default", func(req *http.UpdateRecordRequest) {
+			ods := "fa123"
+			req.Encounter.PerformerODS = &ods
+		}, ""},
+		{"another patient", func(req *http.UpdateRecordRequest) { req.Patient.NhsNumber = "9434765919" }, "patient.nhsNumber"},
+		{"another practice", func(req *http.UpdateRecordRequest) { req.Routing.RegisteredPracticeODS = "G85002" }, "routing.registeredPracticeODS"},
+		{"another sender", func(req *http.UpdateRecordRequest) {
+			ods := "FB456"
+			req.Encounter.PerformerODS = &ods
+		}, "sender ODS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CorrectUpdateRecord(testRequest(t, tt.change), testConfig, Correction{
+				Status:           CorrectionAmended,
+				ReplacesDocument: sent.DocumentID,
+				ResourceIDs:      sent.ResourceIDs,
+				Original:         orig,
+			})
+			switch {
+			case tt.field == "" && err != nil:
+				t.Errorf("got %v, want the amendment built", err)
+			case tt.field != "" && (!errors.Is(err, ErrCorrectionMismatch) || !strings.Contains(err.Error(), tt.field)):
+				t.Errorf("got %v, want a mismatch on %s", err, tt.field)
+			}
+		})
+	}
+}
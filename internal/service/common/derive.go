@@ -0,0 +1,153 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ------------ Derived observations ------------- */
+
+// ValidationWarning is a non-fatal problem found while preparing a request.
+// The message is still built; warnings are reported back to the client.
+type ValidationWarning struct {
+	Field   string
+	Message string
+}
+
+func (w ValidationWarning) String() string { return w.Field + ": " + w.Message }
+
+const (
+	snomedHeight = "50373000"
+	snomedWeight = "27113001"
+	snomedBMI    = "60621009"
+
+	// bmiTolerance is how far a client-supplied BMI may drift from the value
+	// derived from height and weight before we flag it.
+	bmiTolerance = 0.1
+)
+
+// plausibleBody bounds the heights (cm) and weights (kg) BMI is derived
+// from; anything outside is more likely a typo or a unit slip than a person.
+var plausibleBody = map[string][2]float64{
+	"cm": {20, 300},
+	"kg": {0.2, 700},
+}
+
+// canonicalUnits maps SNOMED observation codes to the UCUM unit we record
+// them in; any other unit of the same dimension is converted.
+var canonicalUnits = map[string]struct{ code, display string }{
+	snomedHeight: {"cm", "centimeter"},
+	"248333004":  {"cm", "centimeter"}, // standing height
+	snomedWeight: {"kg", "kilogram"},
+	"363808001":  {"kg", "kilogram"}, // measured body weight
+	snomedBMI:    {"kg/m2", "kilogram per square meter"},
+}
+
+// ucumToCanonical holds multiplication factors from a UCUM unit to the
+// canonical unit of its dimension.
+var ucumToCanonical = map[string]map[string]float64{
+	"cm": {"cm": 1, "m": 100, "mm": 0.1, "[in_i]": 2.54, "[ft_i]": 30.48},
+	"kg": {"kg": 1, "g": 0.001, "[lb_av]": 0.45359237, "[oz_av]": 0.028349523125, "[stone_av]": 6.35029318},
+}
+
+// deriveObservations normalises body measurements to canonical UCUM units,
+// derives BMI from a plausible height and weight, and warns when a
+// client-supplied BMI disagrees with the measured values or a measurement
+// is too implausible to derive from.
+func deriveObservations(req http.UpdateRecordRequest) (http.UpdateRecordRequest, []ValidationWarning) {
+	if req.Observations == nil {
+		return req, nil
+	}
+	var warnings []ValidationWarning
+	obs := append([]http.ObservationInput(nil), *req.Observations...)
+
+	height, weight, bmi := -1, -1, -1
+	for i := range obs {
+		if obs[i].Code.System != "http://snomed.info/sct" {
+			continue
+		}
+		if w := normaliseUnit(&obs[i]); w != "" {
+			warnings = append(warnings, ValidationWarning{Field: fmt.Sprintf("observations[%d].valueQuantity", i), Message: w})
+		}
+		switch obs[i].Code.Code {
+		case snomedHeight, "248333004":
+			height = i
+		case snomedWeight, "363808001":
+			weight = i
+		case snomedBMI:
+			bmi = i
+		}
+	}
+
+	if height >= 0 && weight >= 0 && isCanonical(obs[height]) && isCanonical(obs[weight]) {
+		usable := true
+		for _, i := range []int{height, weight} {
+			if w := implausible(obs[i]); w != "" {
+				warnings = append(warnings, ValidationWarning{Field: fmt.Sprintf("observations[%d].valueQuantity", i), Message: w})
+				usable = false
+			}
+		}
+		m := floatOf(obs[height].ValueQuantity.Value) / 100
+		derived := round1(floatOf(obs[weight].ValueQuantity.Value) / (m * m))
+		switch {
+		case !usable:
+		case bmi < 0:
+			at := obs[weight].EffectiveDateTime
+			if at.IsZero() {
+				at = time.Now()
+			}
+			ob := vitalSign(snomed(snomedBMI, "Body mass index"), numberOf(derived), "kilogram per square meter", "kg/m2", at)
+			ob.Id = generatedID(obs, ob.Code)
+			obs = append(obs, ob)
+		case obs[bmi].ValueQuantity != nil && math.Abs(floatOf(obs[bmi].ValueQuantity.Value)-derived) > bmiTolerance:
+			warnings = append(warnings, ValidationWarning{
+				Field:   fmt.Sprintf("observations[%d].valueQuantity", bmi),
+				Message: fmt.Sprintf("BMI %s does not match %.1f derived from height and weight", obs[bmi].ValueQuantity.Value, derived),
+			})
+		}
+	}
+
+	req.Observations = &obs
+	return req, warnings
+}
+
+// normaliseUnit converts the observation's quantity to the canonical unit for
+// its code. It returns a warning if the unit can't be converted.
+func normaliseUnit(ob *http.ObservationInput) string {
+	canon, ok := canonicalUnits[ob.Code.Code]
+	q := ob.ValueQuantity
+	if !ok || q == nil || q.Code == nil || *q.Code == canon.code {
+		return ""
+	}
+	if q.System != nil && *q.System != ucumSystem {
+		return fmt.Sprintf("unit %q is not UCUM; expected %s", *q.Code, canon.code)
+	}
+	factor, ok := ucumToCanonical[canon.code][*q.Code]
+	if !ok {
+		return fmt.Sprintf("unit %q cannot be converted to %s", *q.Code, canon.code)
+	}
+	ob.ValueQuantity = ucumQuantity(numberOf(round2(floatOf(q.Value)*factor)), canon.display, canon.code)
+	return ""
+}
+
+func isCanonical(ob http.ObservationInput) bool {
+	canon := canonicalUnits[ob.Code.Code]
+	return ob.ValueQuantity != nil && ob.ValueQuantity.Code != nil && *ob.ValueQuantity.Code == canon.code
+}
+
+// implausible describes why a canonical height or weight can't be used to
+// derive BMI, or is empty.
+func implausible(ob http.ObservationInput) string {
+	q := ob.ValueQuantity
+	bounds := plausibleBody[*q.Code]
+	if v, err := q.Value.Float64(); err != nil || v < bounds[0] || v > bounds[1] {
+		return fmt.Sprintf("%s %s is outside %g-%g %s; BMI not derived", q.Value, *q.Code, bounds[0], bounds[1], *q.Code)
+	}
+	return ""
+}
+
+func round1(f float64) float64 { return math.Round(f*10) / 10 }
+func round2(f float64) float64 { return math.Round(f*100) / 100 }
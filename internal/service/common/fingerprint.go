@@ -0,0 +1,148 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ---- Duplicate fingerprint ---- */
+
+// updateRecordFingerprint hashes the clinically meaningful content of an
+// Update Record: the patient, when the consultation happened, what kind of
+// record it is and the clinical entries made (observations, supplies,
+// procedures, immunisations, referrals). Two requests that agree on all of
+// these describe the same consultation, whatever IDs or wording they carry.
+//
+// It is "" when the request has no clinical entries, since the patient,
+// time and record type alone would match every visit made at that time.
+func updateRecordFingerprint(req http.UpdateRecordRequest) string {
+	var entries []string
+	if req.Observations != nil {
+		for _, ob := range *req.Observations {
+			entries = append(entries, "observation:"+observationFingerprint(ob))
+		}
+	}
+	if req.ClinicalSummary.MedicationsSupplied != nil {
+		for _, ms := range *req.ClinicalSummary.MedicationsSupplied {
+			var handedOver string
+			if ms.WhenHandedOver != nil {
+				handedOver = ms.WhenHandedOver.String()
+			}
+			entries = append(entries, "medication:"+codeKey(ms.Medication.System, ms.Medication.Code)+"@"+handedOver+
+				"="+string(ms.Status)+" "+quantityKey(ms.Quantity)+"/"+quantityKey(ms.DaysSupply))
+		}
+	}
+	if req.Procedures != nil {
+		for _, p := range *req.Procedures {
+			entries = append(entries, "procedure:"+codeKey(p.Code.System, p.Code.Code)+"@"+fingerprintTime(p.PerformedDateTime))
+		}
+	}
+	if req.Immunizations != nil {
+		for _, im := range *req.Immunizations {
+			notGiven := im.NotGiven != nil && *im.NotGiven
+			entries = append(entries, "immunization:"+codeKey(im.VaccineProduct.System, im.VaccineProduct.Code)+"@"+fingerprintTime(im.Date)+
+				"="+strconv.FormatBool(notGiven))
+		}
+	}
+	if req.Referrals != nil {
+		for _, r := range *req.Referrals {
+			var service string
+			if r.ServiceRequested != nil {
+				service = codeKey(r.ServiceRequested.System, r.ServiceRequested.Code)
+			}
+			entries = append(entries, "referral:"+codeKey(r.Reason.System, r.Reason.Code)+">"+strings.ToUpper(strings.TrimSpace(r.RecipientODS))+"="+service)
+		}
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+	// the order entries are listed in doesn't change the consultation
+	sort.Strings(entries)
+
+	primary, _ := resolveEncounters(req)
+	var occurred string
+	if primary.OccurredAt != nil {
+		occurred = fingerprintTime(*primary.OccurredAt)
+	}
+	cc := codedOrDefault(req.Composition)
+	lines := []string{
+		"nhs:" + nhsNumberKey(req.Patient.NhsNumber),
+		"encounter:" + occurred,
+		"composition:" + codeKey(cc.System, cc.Code),
+	}
+	lines = append(lines, entries...)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// observationFingerprint is an observation's code, effective time and value.
+// Status, interpretation and reference ranges are left out: a resend that
+// only adds a flag is still the same reading.
+func observationFingerprint(ob http.ObservationInput) string {
+	value := struct {
+		Quantity   string            `json:"q,omitempty"`
+		Coded      string            `json:"c,omitempty"`
+		String     *string           `json:"s,omitempty"`
+		Boolean    *bool             `json:"b,omitempty"`
+		Period     *http.Period      `json:"p,omitempty"`
+		Components map[string]string `json:"x,omitempty"`
+	}{
+		Quantity: quantityKey(ob.ValueQuantity),
+		String:   ob.ValueString,
+		Boolean:  ob.ValueBoolean,
+		Period:   ob.ValuePeriod,
+	}
+	if ob.ValueCodeableConcept != nil {
+		value.Coded = codeKey(ob.ValueCodeableConcept.System, ob.ValueCodeableConcept.Code)
+	}
+	if ob.Components != nil {
+		value.Components = map[string]string{}
+		for _, c := range *ob.Components {
+			v := quantityKey(c.ValueQuantity)
+			if c.ValueCodeableConcept != nil {
+				v = codeKey(c.ValueCodeableConcept.System, c.ValueCodeableConcept.Code)
+			}
+			value.Components[codeKey(c.Code.System, c.Code.Code)] = v
+		}
+	}
+	b, _ := json.Marshal(value) // map keys marshal sorted
+	return codeKey(ob.Code.System, ob.Code.Code) + "@" + fingerprintTime(ob.EffectiveDateTime) + "=" + string(b)
+}
+
+// quantityKey is a quantity's value in lowest terms, so 72, 72.0 and 7.2e1
+// match, with its UCUM code; the display unit only counts when there is no
+// code.
+func quantityKey(q *http.Quantity) string {
+	if q == nil {
+		return ""
+	}
+	value := strings.TrimSpace(string(q.Value))
+	if r, ok := new(big.Rat).SetString(value); ok {
+		value = r.RatString()
+	}
+	unit := ""
+	switch {
+	case q.Code != nil && strings.TrimSpace(*q.Code) != "":
+		unit = strings.TrimSpace(*q.Code)
+	case q.Unit != nil:
+		unit = "~" + strings.TrimSpace(*q.Unit)
+	}
+	return value + " " + unit
+}
+
+func fingerprintTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// codeKey is a coding in FHIR token form, system|code.
+func codeKey(system, code string) string {
+	return strings.TrimSpace(system) + "|" + strings.TrimSpace(code)
+}
@@ -0,0 +1,130 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+const fingerprintRequest = `{
+	"patient": {"nhsNumber": "9876543210", "dateOfBirth": "1990-02-17", "surname": "SMITH"},
+	"encounter": {"occurredAt": "2024-05-01T10:15:00+01:00"},
+	"observations": [
+		{"id": "hr", "status": "final", "code": {"system": "http://loinc.org", "code": "8867-4", "display": "Heart rate"}, "effectiveDateTime": "2024-05-01T10:15:00+01:00", "valueQuantity": {"value": 72, "unit": "/min", "code": "/min"}},
+		{"id": "temp", "status": "final", "code": {"system": "http://loinc.org", "code": "8310-5", "display": "Body temperature"}, "effectiveDateTime": "2024-05-01T10:15:00+01:00", "valueQuantity": {"value": 37.2, "unit": "°C", "code": "Cel"}}
+	]
+}`
+
+func TestUpdateRecordFingerprint(t *testing.T) {
+	parse := func(t *testing.T) http.UpdateRecordRequest {
+		t.Helper()
+		var req http.UpdateRecordRequest
+		if err := json.Unmarshal([]byte(fingerprintRequest), &req); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	base := updateRecordFingerprint(parse(t))
+	if base == "" {
+		t.Fatal("no fingerprint for a request with an encounter and observations")
+	}
+
+	tests := []struct {
+		name   string
+		change func(req *http.UpdateRecordRequest)
+		same   bool
+	}{
+		{"observations reordered", func(req *http.UpdateRecordRequest) {
+			obs := *req.Observations
+			obs[0], obs[1] = obs[1], obs[0]
+		}, true},
+		{"client ids changed", func(req *http.UpdateRecordRequest) {
+			(*req.Observations)[0].Id = "heart-rate"
+		}, true},
+		{"interpretation flag added", func(req *http.UpdateRecordRequest) {
+			(*req.Observations)[0].Interpretation = &http.CodedItem{System: "http://hl7.org/fhir/v2/0078", Code: "N"}
+		}, true},
+		{"status changed", func(req *http.UpdateRecordRequest) {
+			(*req.Observations)[0].Status = "amended"
+		}, true},
+		{"NHS number spaced", func(req *http.UpdateRecordRequest) {
+			req.Patient.NhsNumber = "987 654 3210"
+		}, true},
+		{"encounter time in another zone", func(req *http.UpdateRecordRequest) {
+			at := req.Encounter.OccurredAt.In(time.UTC)
+			req.Encounter.OccurredAt = &at
+		}, true},
+		{"value written with a decimal", func(req *http.UpdateRecordRequest) {
+			(*req.Observations)[0].ValueQuantity.Value = "72.0"
+		}, true},
+		{"value written with an exponent", func(req *http.UpdateRecordRequest) {
+			(*req.Observations)[0].ValueQuantity.Value = "7.2e1"
+		}, true},
+		{"unit displayed differently", func(req *http.UpdateRecordRequest) {
+			unit := "beats per minute"
+			(*req.Observations)[0].ValueQuantity.Unit = &unit
+		}, true},
+		{"value changed", func(req *http.UpdateRecordRequest) {
+			(*req.Observations)[0].ValueQuantity.Value = "80"
+		}, false},
+		{"observation dropped", func(req *http.UpdateRecordRequest) {
+			obs := (*req.Observations)[:1]
+			req.Observations = &obs
+		}, false},
+		{"another patient", func(req *http.UpdateRecordRequest) {
+			req.Patient.NhsNumber = "9876543211"
+		}, false},
+		{"encounter a day later", func(req *http.UpdateRecordRequest) {
+			at := req.Encounter.OccurredAt.AddDate(0, 0, 1)
+			req.Encounter.OccurredAt = &at
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := parse(t)
+			tt.change(&req)
+			if got := updateRecordFingerprint(req); (got == base) != tt.same {
+				t.Errorf("fingerprint same = %v, want %v", got == base, tt.same)
+			}
+		})
+	}
+}
+
+func TestUpdateRecordFingerprintWithoutObservations(t *testing.T) {
+	supplied := func(code string) string {
+		var req http.UpdateRecordRequest
+		if err := json.Unmarshal([]byte(`{
+			"patient": {"nhsNumber": "9876543210"},
+			"encounter": {"occurredAt": "2024-05-01T10:15:00+01:00"},
+			"clinicalSummary": {"medicationsSupplied": [
+				{"status": "completed", "medication": {"system": "http://snomed.info/sct", "code": "`+code+`"}, "quantity": {"value": 28, "unit": "tablet"}}
+			]}
+		}`), &req); err != nil {
+			t.Fatal(err)
+		}
+		return updateRecordFingerprint(req)
+	}
+	a, b := supplied("39720311000001101"), supplied("42206511000001102")
+	if a == "" {
+		t.Fatal("no fingerprint for a request that only supplies a medicine")
+	}
+	if a == b {
+		t.Error("two visits supplying different medicines at the same time have the same fingerprint")
+	}
+	if supplied("39720311000001101") != a {
+		t.Error("the same supply has a different fingerprint")
+	}
+}
+
+func TestUpdateRecordFingerprintNeedsContent(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)
+	req := http.UpdateRecordRequest{
+		Patient:   http.Patient{NhsNumber: "9876543210"},
+		Encounter: &http.Encounter{OccurredAt: &at},
+	}
+	if got := updateRecordFingerprint(req); got != "" {
+		t.Errorf("got %q for a request with no clinical entries, want none", got)
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/dmd"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/ods"
 	"github.com/google/uuid"
 )
 
@@ -16,125 +19,380 @@ import (
 
 type Config struct {
 	SenderMeshMailbox                 string
-	DefaultSenderODS                  string
+	SenderASID                        string // when set, requests must carry this ASID or none
+	IdentifierSystem                  string // base of the business identifier systems; DefaultIdentifierSystem when empty
+	DefaultSenderODS                  string // used when the request names no performer ODS
 	DefaultBusinessAckRequested       bool
 	DefaultInfrastructureAckRequested bool
-	DefaultRecipientType              string // e.g. "FI"
+	DefaultRecipientType              string          // e.g. "FI"
+	DeriveInterpretation              bool            // flag known vitals against NICE thresholds
+	Sites                             *ods.Directory  // local ODS dataset for code checks and Organization/Location details; may be nil
+	Medicines                         *dmd.Dictionary // local dm+d extract for medication code checks; may be nil
+}
+
+// BuildResult is a built Update Record message plus any non-fatal warnings
+// raised while preparing the request.
+type BuildResult struct {
+	XML         []byte
+	Warnings    []ValidationWarning
+	DocumentID  string            // document Bundle fullUrl
+	ResourceIDs map[string]string // resource fullUrls by key, for corrections
+	Fingerprint string            // hash of the clinical content for duplicate checks; "" when too sparse
+
+	entries []Entry           // document entries after the Composition, for an amendment to pick from
+	filed   map[string]string // heading code by fullUrl of the entries filed in a section
 }
 
 func BuildUpdateRecordFHIRXML(req http.UpdateRecordRequest, cfg Config) ([]byte, error) {
+	res, err := BuildUpdateRecord(req, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return res.XML, nil
+}
+
+func BuildUpdateRecord(req http.UpdateRecordRequest, cfg Config) (*BuildResult, error) {
+	return buildUpdateRecord(updateRecord, req, cfg, nil)
+}
+
+func buildUpdateRecord(mt MessageType, req http.UpdateRecordRequest, cfg Config, correction *Correction) (*BuildResult, error) {
+	// A retraction resends what was accepted before; ODS and dm+d checks
+	// are as of today, and a practice closing since mustn't block it.
+	sites, medicines := cfg.Sites, cfg.Medicines
+	if correction != nil && correction.Status == CorrectionEnteredInError {
+		sites, medicines = nil, nil
+	}
+	req, err := ExpandServiceTemplate(req)
+	if err != nil {
+		return nil, err
+	}
+	req, err = applySenderASID(req, cfg.SenderASID)
+	if err != nil {
+		return nil, err
+	}
 	if err := validateMinimal(req); err != nil {
 		return nil, err
 	}
-	now := time.Now().UTC()
-	lastUpdated := now.Format(time.RFC3339Nano)
+	if err := validatePharmacyFirst(req); err != nil {
+		return nil, err
+	}
+	if err := validateEncounters(req); err != nil {
+		return nil, err
+	}
+	if err := validateHeadings(req); err != nil {
+		return nil, err
+	}
+	if err := validateProcedures(req); err != nil {
+		return nil, err
+	}
+	if err := validateReferrals(req); err != nil {
+		return nil, err
+	}
+	if err := validateSourceIDs(req); err != nil {
+		return nil, err
+	}
+	if err := validateParticipants(req); err != nil {
+		return nil, err
+	}
+	if err := validateODSCodes(req, cfg.DefaultSenderODS, sites, time.Now().In(ukZone)); err != nil {
+		return nil, err
+	}
+	if err := validatePractitioners(req); err != nil {
+		return nil, err
+	}
+	if err := validateObservations(req); err != nil {
+		return nil, err
+	}
+	req = expandPharmacyFirstPathway(req)
+	fingerprint := updateRecordFingerprint(req)
+	warnings, err := validateMedications(req, medicines)
+	if err != nil {
+		return nil, err
+	}
+	vaccineWarnings, err := validateImmunizations(req, medicines)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, vaccineWarnings...)
+	req, derived := deriveObservations(req)
+	warnings = append(warnings, derived...)
+	if cfg.DeriveInterpretation {
+		req = deriveInterpretations(req)
+	}
+	// one build time for meta.lastUpdated, MessageHeader.timestamp and the document dates
+	now := time.Now().Truncate(time.Millisecond)
+	lastUpdated := fhirDateTime(now)
+
+	// sender ODS
+	senderODS := SenderODS(req)
+	if senderODS == "" {
+		senderODS = strings.TrimSpace(cfg.DefaultSenderODS)
+	}
+	if senderODS == "" {
+		return nil, errors.New("encounter.performerODS is required: no default sender ODS is configured")
+	}
 
-	// IDs (urn:uuid)
+	// IDs (urn:uuid). The message envelope is always new; document resources
+	// are keyed so a correction can reuse the originals, and resources with a
+	// source ID get one derived from it and the sender. A retraction rebuilds the original
+	// request, so even resources known only by position keep their IDs.
+	var reuse map[string]string
+	if correction != nil {
+		reuse = correction.ResourceIDs
+	}
+	ids := newResourceIDs(reuse, correction != nil && correction.Status == CorrectionEnteredInError)
+	idents := newIdentifiers(cfg.IdentifierSystem, senderODS)
 	msgHeaderID := newURN()
 	headerOrgID := newURN()
 	docBundleID := newURN()
-	compID := newURN()
-	patientID := newURN()
-	practID := newURN()
-	practRoleID := newURN()
-	encPrimaryID := newURN()
-
-	// sender ODS
-	senderODS := cfg.DefaultSenderODS
-	if req.Encounter != nil && req.Encounter.PerformerODS != nil {
-		senderODS = *req.Encounter.PerformerODS
-	}
-	if req.Encounters != nil {
-		for _, e := range *req.Encounters {
-			if e.Role != nil && *e.Role == "primary" && e.PerformerODS != nil {
-				senderODS = *e.PerformerODS
-				break
-			}
-		}
+	var compSourceID *string
+	if req.Composition != nil {
+		compSourceID = req.Composition.SourceId
 	}
+	compID := idents.stableID(ids, "composition", "composition", compSourceID)
+	patientID := ids.id("patient")
+	practID := ids.id("practitioner")
+	practRoleID := ids.id("practitioner-role")
 
 	// Build document bundle entries (order: Composition first)
 	var docEntries []Entry
 
 	// Patient
 	patient := makePatient(patientID, req.Patient, lastUpdated)
+	patient.Text = patientNarrative(patient)
 	docEntries = append(docEntries, Entry{FullURL: patientID, Resource: EntryResource{Patient: &patient}})
 
 	// Org (service provider)
-	orgDocID := newURN()
-	orgDoc := makeOrganization(orgDocID, "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-GPC-Organization-1", senderODS, lastUpdated)
+	orgDocID := ids.id("organization")
+	orgDoc := makeOrganization(orgDocID, "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-GPC-Organization-1", senderODS, cfg.Sites, lastUpdated)
+	orgDoc.Text = organizationNarrative(orgDoc)
 	docEntries = append(docEntries, Entry{FullURL: orgDocID, Resource: EntryResource{Organization: &orgDoc}})
 
 	// Practitioner
-	// todo
 	pr := makePractitioner(practID, req.Provenance.Author, lastUpdated)
+	pr.Text = practitionerNarrative(pr)
 	docEntries = append(docEntries, Entry{FullURL: practID, Resource: EntryResource{Practitioner: &pr}})
 
 	// PractitionerRole (optional when role provided)
 	if req.Provenance.Author.Role != nil && req.Provenance.Author.Role.System != "" && req.Provenance.Author.Role.Code != "" {
 		prRole := makePractitionerRole(practRoleID, practID, orgDocID, *req.Provenance.Author.Role, lastUpdated)
+		prRole.Text = practitionerRoleNarrative(prRole)
 		docEntries = append(docEntries, Entry{FullURL: practRoleID, Resource: EntryResource{PractitionerRole: &prRole}})
 	}
 
-	// Encounters (choose primary)
+	// performerFor returns the Practitioner for a clinician, adding one (and
+	// a PractitionerRole when a role is given) per distinct clinician; no
+	// clinician, or the author, means the author.
+	performers := map[string]string{clinicianKey(req.Provenance.Author): practID}
+	performerFor := func(a *http.Author) string {
+		if a == nil {
+			return practID
+		}
+		key := clinicianKey(*a)
+		if id, ok := performers[key]; ok {
+			return id
+		}
+		id := ids.id("practitioner/" + key)
+		performers[key] = id
+		perf := makePractitioner(id, *a, lastUpdated)
+		perf.Text = practitionerNarrative(perf)
+		docEntries = append(docEntries, Entry{FullURL: id, Resource: EntryResource{Practitioner: &perf}})
+		if a.Role != nil && a.Role.System != "" && a.Role.Code != "" {
+			roleID := ids.id("practitioner-role/" + key)
+			role := makePractitionerRole(roleID, id, orgDocID, *a.Role, lastUpdated)
+			role.Text = practitionerRoleNarrative(role)
+			docEntries = append(docEntries, Entry{FullURL: roleID, Resource: EntryResource{PractitionerRole: &role}})
+		}
+		return id
+	}
+
+	// Participants (recorder, performer, authoriser)
+	team := newCareTeam(req, practID, performerFor)
+
+	// Device for the sending system
+	deviceID := ids.id("device")
+	device := makeDevice(deviceID, *req.Provenance.System, orgDocID, lastUpdated)
+	device.Text = deviceNarrative(device)
+	docEntries = append(docEntries, Entry{FullURL: deviceID, Resource: EntryResource{Device: &device}})
+
+	// Locations, one per distinct ODS site code across the encounters
+	locationRefs := map[string]string{}
+	locationFor := func(e http.Encounter) []EncounterLocation {
+		if e.LocationODS == nil || strings.TrimSpace(*e.LocationODS) == "" {
+			return nil
+		}
+		code := strings.ToUpper(strings.TrimSpace(*e.LocationODS))
+		locID, ok := locationRefs[code]
+		if !ok {
+			locID = ids.id("location/" + code)
+			locationRefs[code] = locID
+			loc := makeLocation(locID, code, orgDocID, cfg.Sites, lastUpdated)
+			loc.Text = locationNarrative(loc)
+			docEntries = append(docEntries, Entry{FullURL: locID, Resource: EntryResource{Location: &loc}})
+		}
+		return encounterLocation(locID)
+	}
+
+	// Encounters (choose primary; related ones are partOf the primary)
 	primary, related := resolveEncounters(req)
-	encPrimary := makeEncounter(encPrimaryID, primary, patientID, practID, orgDocID, lastUpdated)
+	encPrimaryID := idents.stableID(ids, "encounter/primary", "encounter", primary.Encounter.SourceId)
+	encounterRefs := map[string]string{}
+	if primary.ID != "" {
+		encounterRefs[primary.ID] = encPrimaryID
+	}
+	encPrimary := makeEncounter(encPrimaryID, idents.forResource("encounter", primary.Encounter.SourceId, encPrimaryID), primary.Encounter, patientID, team.encounterParticipants(), orgDocID, lastUpdated)
+	encPrimary.Location = locationFor(primary.Encounter)
+	encPrimary.Text = encounterNarrative(encPrimary)
 	docEntries = append(docEntries, Entry{FullURL: encPrimaryID, Resource: EntryResource{Encounter: &encPrimary}})
-	for range related {
-		relID := newURN()
-		e := makeEncounter(relID, primary, patientID, practID, orgDocID, lastUpdated) // clone shape; adjust if you carry distinct data
+	for i, rel := range related {
+		relID := idents.itemID(ids, "encounter", rel.Encounter.SourceId, &rel.ID, i)
+		if rel.ID != "" {
+			encounterRefs[rel.ID] = relID
+		}
+		e := makeEncounter(relID, idents.forResource("encounter", rel.Encounter.SourceId, relID), rel.Encounter, patientID, team.encounterParticipants(), orgDocID, lastUpdated)
+		e.Location = locationFor(rel.Encounter)
+		e.Text = encounterNarrative(e)
+		e.PartOf = &struct {
+			Reference Reference `xml:"reference"`
+		}{Reference: Reference{RefValue: idRef(encPrimaryID)}}
 		docEntries = append(docEntries, Entry{FullURL: relID, Resource: EntryResource{Encounter: &e}})
 	}
+	// encounterFor maps a client encounter ID to its fullUrl, defaulting to
+	// the primary; validateEncounters has rejected IDs that weren't sent.
+	encounterFor := func(ref *string) string {
+		if ref != nil {
+			if id, ok := encounterRefs[*ref]; ok {
+				return id
+			}
+		}
+		return encPrimaryID
+	}
+
+	// Composition sections, one per Record Standard Heading used
+	sections := newSectionModel()
+	sections.note(headingClinicalSummary, req.ClinicalSummary.FreeText)
 
 	// Observations
 	if req.Observations != nil {
-		for _, ob := range *req.Observations {
-			oid := newURN()
-			obs := makeObservation(oid, ob, patientID, encPrimaryID, practID, lastUpdated)
+		for i, ob := range *req.Observations {
+			oid := idents.itemID(ids, "observation", ob.SourceId, &ob.Id, i)
+			obs := makeObservation(oid, idents.forResource("observation", ob.SourceId, oid), ob, patientID, encounterFor(&ob.ContextEncounterRef), team.observationPerformer(ob.PerformerRef), lastUpdated)
+			obs.Text = observationNarrative(obs)
+			sections.add(observationHeading(ob), oid, obs.Text)
 			docEntries = append(docEntries, Entry{FullURL: oid, Resource: EntryResource{Observation: &obs}})
 		}
 	}
 
-	// Narrative sections -> ClinicalImpression
-	if req.NarrativeSections != nil {
-		for _, nb := range *req.NarrativeSections {
-			cid := newURN()
-			ci := makeClinicalImpression(cid, nb, patientID, encPrimaryID, practID, lastUpdated)
-			docEntries = append(docEntries, Entry{FullURL: cid, Resource: EntryResource{ClinicalImpression: &ci}})
+	// Procedures
+	if req.Procedures != nil {
+		for i, p := range *req.Procedures {
+			pid := idents.itemID(ids, "procedure", p.SourceId, p.Id, i)
+			proc := makeProcedure(pid, idents.forResource("procedure", p.SourceId, pid), p, patientID, encounterFor(p.ContextEncounterRef), performerFor(p.Performer), lastUpdated)
+			proc.Text = procedureNarrative(proc)
+			docEntries = append(docEntries, Entry{FullURL: pid, Resource: EntryResource{Procedure: &proc}})
+			sections.add(procedureHeading(p), pid, proc.Text)
+		}
+	}
+
+	// Immunizations
+	if req.Immunizations != nil {
+		for i, im := range *req.Immunizations {
+			iid := idents.itemID(ids, "immunization", im.SourceId, im.Id, i)
+			imm := makeImmunization(iid, idents.forResource("immunization", im.SourceId, iid), im, patientID, encounterFor(im.ContextEncounterRef), performerFor(im.Performer), lastUpdated)
+			imm.Text = immunizationNarrative(imm)
+			docEntries = append(docEntries, Entry{FullURL: iid, Resource: EntryResource{Immunization: &imm}})
+			sections.add(immunizationHeading(im), iid, imm.Text)
+		}
+	}
+
+	// Referrals, with an Organization per distinct recipient
+	if req.Referrals != nil {
+		recipients := map[string]string{}
+		for i, r := range *req.Referrals {
+			code := strings.ToUpper(strings.TrimSpace(r.RecipientODS))
+			recipientID, ok := recipients[code]
+			if !ok {
+				recipientID = ids.id("organization/" + code)
+				recipients[code] = recipientID
+				org := makeOrganization(recipientID, "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-GPC-Organization-1", code, cfg.Sites, lastUpdated)
+				org.Text = organizationNarrative(org)
+				docEntries = append(docEntries, Entry{FullURL: recipientID, Resource: EntryResource{Organization: &org}})
+			}
+			rid := idents.itemID(ids, "referral", r.SourceId, r.Id, i)
+			ref := makeReferralRequest(rid, idents.forResource("referral", r.SourceId, rid), r, patientID, encounterFor(r.ContextEncounterRef), performerFor(r.Requester), orgDocID, recipientID, now, lastUpdated)
+			ref.Text = referralRequestNarrative(ref)
+			docEntries = append(docEntries, Entry{FullURL: rid, Resource: EntryResource{ReferralRequest: &ref}})
+			sections.add(referralHeading(r), rid, ref.Text)
 		}
 	}
 
-	// Attachments -> DocumentReference
-	if req.Attachments != nil {
-		/*for _, att := range *req.Attachments {
-			if _, err := base64.StdEncoding.DecodeString(att.Base64); err != nil {
-				return nil, fmt.Errorf("attachment %q is not valid base64: %w", att.Title, err)
+	// Narrative sections -> ClinicalImpression
+	if req.NarrativeSections != nil {
+		for i, nb := range *req.NarrativeSections {
+			cid := idents.itemID(ids, "clinical-impression", nb.SourceId, nil, i)
+			ci := makeClinicalImpression(cid, idents.forResource("clinical-impression", nb.SourceId, cid), nb, patientID, encounterFor(nb.ContextEncounterRef), practID, lastUpdated)
+			heading := string(nb.HeadingCode)
+			if nb.HeadingDisplay != nil {
+				heading = *nb.HeadingDisplay
 			}
-			drID := newURN()
-			dr := makeDocumentReference(drID, att, patientID, lastUpdated)
-			//docEntries = append(docEntries, Entry{FullURL: drID, Resource: EntryResource{DocumentBundle: &dr}})
-		}*/ // todo
+			ci.Text = clinicalImpressionNarrative(heading, ci)
+			sections.add(nb.HeadingCode, cid, ci.Text)
+			docEntries = append(docEntries, Entry{FullURL: cid, Resource: EntryResource{ClinicalImpression: &ci}})
+		}
 	}
 
 	// NEW: medications
 	if req.ClinicalSummary.MedicationsSupplied != nil && len(*req.ClinicalSummary.MedicationsSupplied) > 0 {
-		for _, ms := range *req.ClinicalSummary.MedicationsSupplied {
-			mdEntry, _ := makeMedicationDispense(ms, patientID, encPrimaryID, practID, lastUpdated)
+		for i, ms := range *req.ClinicalSummary.MedicationsSupplied {
+			mdID := idents.itemID(ids, "medication-dispense", ms.SourceId, nil, i)
+			mdEntry := makeMedicationDispense(mdID, idents.forResource("medication-dispense", ms.SourceId, mdID), ms, patientID, encPrimaryID, practID, lastUpdated)
 			docEntries = append(docEntries, mdEntry)
+			sections.add(headingMedications, mdID, mdEntry.Resource.MedicationDispense.Text)
+		}
+	}
+
+	// An amendment retracts what it leaves out of the original
+	if correction != nil && correction.Status == CorrectionAmended {
+		dropped, err := droppedEntries(correction, cfg, docEntries)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range dropped {
+			docEntries = append(docEntries, d.Entry)
+			if d.heading != "" {
+				sections.add(d.heading, d.FullURL, nil)
+			}
 		}
 	}
+	contentEntries := docEntries
 
 	// Composition (first entry in document bundle)
-	comp := makeComposition(compID, req, patientID, encPrimaryID, practID, lastUpdated)
+	comp := makeComposition(compID, mt.Profiles.Composition, idents.forResource("composition", compSourceID, compID), req, patientID, encPrimaryID, team.authorisers(), sections.build(), lastUpdated)
+	reason := ""
+	if correction != nil {
+		applyCorrection(&comp, *correction)
+		reason = correction.Reason
+		if correction.Status == CorrectionEnteredInError {
+			markEnteredInError(docEntries)
+		}
+	}
+	comp.Text = compositionNarrative(comp, req.ClinicalSummary.FreeText, reason)
+	if req.Provenance.IncludeResource != nil && *req.Provenance.IncludeResource {
+		provID := ids.id("provenance")
+		signer := team.authorisers()[0]
+		prov := makeProvenance(provID, compID, signer, orgDocID, deviceID, req.Provenance.SignedAt, now, lastUpdated)
+		prov.Text = provenanceNarrative(prov, team.name(signer), req.Provenance.System.Name)
+		docEntries = append(docEntries, Entry{FullURL: provID, Resource: EntryResource{Provenance: &prov}})
+	}
 	docEntries = append([]Entry{{FullURL: compID, Resource: EntryResource{Composition: &comp}}}, docEntries...)
 
 	// Inner document Bundle
 	docBundle := Bundle{
 		XMLName: xml.Name{Local: "Bundle"},
 		ID:      Attr{Value: trimURN(docBundleID)},
-		Meta:    Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.nhs.uk/STU3/StructureDefinition/ITK-Document-Bundle-1"}},
+		Meta:    Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: mt.Profiles.DocumentBundle}},
 		Identifier: Identifier{
-			System: Attr{Value: "https://fhir.provider.example/identifier/bundle"},
+			System: Attr{Value: bundleIdentifierSystem},
 			Value:  Attr{Value: trimURN(docBundleID)},
 		},
 		Type:  Text{Value: "document"},
@@ -142,18 +400,19 @@ func BuildUpdateRecordFHIRXML(req http.UpdateRecordRequest, cfg Config) ([]byte,
 	}
 
 	// Header Organization for MessageHeader.sender
-	headerOrg := makeOrganization(headerOrgID, "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-ITK-Header-Organization-1", senderODS, lastUpdated)
+	headerOrg := makeOrganization(headerOrgID, mt.Profiles.HeaderOrganization, senderODS, cfg.Sites, lastUpdated)
+	headerOrg.Text = organizationNarrative(headerOrg)
 
 	// MessageHeader
-	msgHeader := makeMessageHeader(msgHeaderID, docBundleID, headerOrgID, cfg, req.MessageHeaderOptions, lastUpdated)
+	msgHeader := makeMessageHeader(msgHeaderID, docBundleID, headerOrgID, mt.Event, mt.Profiles.MessageHeader, cfg, *req.Provenance.System, req.MessageHeaderOptions, lastUpdated)
 
 	// Outer message Bundle
 	msgBundle := Bundle{
 		XMLName: xml.Name{Local: "Bundle"},
 		ID:      Attr{Value: "gpconnect-update-record"},
-		Meta:    Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.nhs.uk/STU3/StructureDefinition/ITK-Message-Bundle-1"}},
+		Meta:    Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: mt.Profiles.MessageBundle}},
 		Identifier: Identifier{
-			System: Attr{Value: "https://fhir.provider.example/identifier/bundle"},
+			System: Attr{Value: bundleIdentifierSystem},
 			Value:  Attr{Value: "gpconnect-update-record"},
 		},
 		Type: Text{Value: "message"},
@@ -166,7 +425,14 @@ func BuildUpdateRecordFHIRXML(req http.UpdateRecordRequest, cfg Config) ([]byte,
 
 	// Marshal with the FHIR namespace
 	withNS := namespaced(msgBundle)
-	return xml.MarshalIndent(withNS, "", "  ")
+	out, err := xml.MarshalIndent(withNS, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &BuildResult{
+		XML: out, Warnings: warnings, DocumentID: docBundleID, ResourceIDs: ids.assigned, Fingerprint: fingerprint,
+		entries: contentEntries, filed: sections.filed,
+	}, nil
 }
 
 /* ------------ Request types (same as earlier design, trimmed) ------------ */
@@ -233,7 +499,13 @@ type EntryResource struct {
 	Observation        *Observation        `xml:"Observation,omitempty"`
 	ClinicalImpression *ClinicalImpression `xml:"ClinicalImpression,omitempty"`
 	Composition        *Composition        `xml:"Composition,omitempty"`
+	Device             *Device             `xml:"Device,omitempty"`
+	Provenance         *ProvenanceXML      `xml:"Provenance,omitempty"`
 	MedicationDispense *MedicationDispense `xml:"MedicationDispense,omitempty"`
+	Location           *Location           `xml:"Location,omitempty"`
+	Procedure          *Procedure          `xml:"Procedure,omitempty"`
+	Immunization       *Immunization       `xml:"Immunization,omitempty"`
+	ReferralRequest    *ReferralRequest    `xml:"ReferralRequest,omitempty"`
 	// ...add other resource types you emit
 }
 
@@ -259,7 +531,11 @@ type MessageHeader struct {
 	} `xml:"sender"`
 	Timestamp Text `xml:"timestamp"`
 	Source    struct {
-		Endpoint Attr `xml:"endpoint"`
+		Extension []SourceExtension `xml:"extension,omitempty"`
+		Name      *Text             `xml:"name,omitempty"`
+		Software  *Text             `xml:"software,omitempty"`
+		Version   *Text             `xml:"version,omitempty"`
+		Endpoint  Attr              `xml:"endpoint"`
 	} `xml:"source"`
 	Focus struct {
 		Reference Reference `xml:"reference"`
@@ -270,6 +546,7 @@ type MHOuterExtension struct {
 	URL       string           `xml:"url,attr"`
 	Extension []MHSubExtension `xml:"extension,omitempty"`
 }
+
 type ValueReference struct {
 	XMLName   xml.Name  `xml:"valueReference"`
 	Reference Reference `xml:"reference"`
@@ -300,11 +577,15 @@ type CodingEvent struct {
 /* ---- Organization ---- */
 
 type Organization struct {
-	XMLName    xml.Name     `xml:"Organization"`
-	ID         Attr         `xml:"id"`
-	Meta       Meta         `xml:"meta"`
-	Identifier []Identifier `xml:"identifier"`
-	Name       *Text        `xml:"name,omitempty"`
+	XMLName    xml.Name       `xml:"Organization"`
+	ID         Attr           `xml:"id"`
+	Meta       Meta           `xml:"meta"`
+	Text       *Narrative     `xml:"text,omitempty"`
+	Identifier []Identifier   `xml:"identifier"`
+	Active     *Text          `xml:"active,omitempty"`
+	Name       *Text          `xml:"name,omitempty"`
+	Telecom    []ContactPoint `xml:"telecom,omitempty"`
+	Address    []Address      `xml:"address,omitempty"`
 }
 
 /* ---- Patient ---- */
@@ -313,6 +594,7 @@ type PatientXML struct {
 	XMLName    xml.Name     `xml:"Patient"`
 	ID         Attr         `xml:"id"`
 	Meta       Meta         `xml:"meta"`
+	Text       *Narrative   `xml:"text,omitempty"`
 	Identifier []Identifier `xml:"identifier"`
 	Name       []HumanName  `xml:"name"`
 	Gender     *Text        `xml:"gender,omitempty"`
@@ -325,9 +607,15 @@ type HumanName struct {
 	Family  Text     `xml:"family"`
 	Given   []Text   `xml:"given,omitempty"`
 	Prefix  []Text   `xml:"prefix,omitempty"`
+	Suffix  []Text   `xml:"suffix,omitempty"`
 }
 type Address struct {
 	XMLName    xml.Name `xml:"address"`
+	Use        *Text    `xml:"use,omitempty"`
+	Type       *Text    `xml:"type,omitempty"`
+	Line       []Text   `xml:"line,omitempty"`
+	City       *Text    `xml:"city,omitempty"`
+	District   *Text    `xml:"district,omitempty"`
 	PostalCode *Text    `xml:"postalCode,omitempty"`
 }
 
@@ -337,13 +625,15 @@ type Practitioner struct {
 	XMLName    xml.Name     `xml:"Practitioner"`
 	ID         Attr         `xml:"id"`
 	Meta       Meta         `xml:"meta"`
+	Text       *Narrative   `xml:"text,omitempty"`
 	Identifier []Identifier `xml:"identifier,omitempty"`
 	Name       []HumanName  `xml:"name,omitempty"`
 }
 type PractitionerRole struct {
-	XMLName      xml.Name `xml:"PractitionerRole"`
-	ID           Attr     `xml:"id"`
-	Meta         Meta     `xml:"meta"`
+	XMLName      xml.Name   `xml:"PractitionerRole"`
+	ID           Attr       `xml:"id"`
+	Meta         Meta       `xml:"meta"`
+	Text         *Narrative `xml:"text,omitempty"`
 	Practitioner struct {
 		Reference Reference `xml:"reference"`
 	} `xml:"practitioner"`
@@ -359,6 +649,7 @@ type EncounterXML struct {
 	XMLName    xml.Name             `xml:"Encounter"`
 	ID         Attr                 `xml:"id"`
 	Meta       Meta                 `xml:"meta"`
+	Text       *Narrative           `xml:"text,omitempty"`
 	Extension  []EncounterExtension `xml:"extension,omitempty"`
 	Identifier []Identifier         `xml:"identifier"`
 	Status     Text                 `xml:"status"`
@@ -368,10 +659,15 @@ type EncounterXML struct {
 	} `xml:"subject"`
 	Participant     []EncounterParticipant `xml:"participant"`
 	Period          *Period                `xml:"period,omitempty"`
+	Length          *Quantity              `xml:"length,omitempty"`
 	Reason          []CodeableConcept      `xml:"reason,omitempty"`
+	Location        []EncounterLocation    `xml:"location,omitempty"`
 	ServiceProvider struct {
 		Reference Reference `xml:"reference"`
 	} `xml:"serviceProvider"`
+	PartOf *struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"partOf,omitempty"`
 }
 type EncounterExtension struct {
 	XMLName xml.Name        `xml:"extension"`
@@ -388,6 +684,7 @@ type EncounterParticipant struct {
 type Period struct {
 	XMLName xml.Name `xml:"period"`
 	Start   Text     `xml:"start"`
+	End     *Text    `xml:"end,omitempty"`
 }
 
 /* ---- Composition ---- */
@@ -396,6 +693,7 @@ type Composition struct {
 	XMLName    xml.Name        `xml:"Composition"`
 	ID         Attr            `xml:"id"`
 	Meta       Meta            `xml:"meta"`
+	Text       *Narrative      `xml:"text,omitempty"`
 	Identifier Identifier      `xml:"identifier"`
 	Status     Text            `xml:"status"`
 	Type       CodeableConcept `xml:"type"`
@@ -409,13 +707,19 @@ type Composition struct {
 	Author []struct {
 		Reference Reference `xml:"reference"`
 	} `xml:"author"`
-	Title   Text `xml:"title"`
-	Section []struct {
-		XMLName xml.Name `xml:"section"`
-		Entry   []struct {
-			Reference Reference `xml:"reference"`
-		} `xml:"entry"`
-	} `xml:"section"`
+	Title     Text                   `xml:"title"`
+	RelatesTo []CompositionRelatesTo `xml:"relatesTo"`
+	Section   []CompositionSection   `xml:"section"`
+}
+
+type CompositionSection struct {
+	XMLName xml.Name         `xml:"section"`
+	Title   *Text            `xml:"title,omitempty"`
+	Code    *CodeableConcept `xml:"code,omitempty"`
+	Text    *Narrative       `xml:"text,omitempty"`
+	Entry   []struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"entry"`
 }
 
 /* ---- Observation ---- */
@@ -424,6 +728,7 @@ type Observation struct {
 	XMLName    xml.Name          `xml:"Observation"`
 	ID         Attr              `xml:"id"`
 	Meta       Meta              `xml:"meta"`
+	Text       *Narrative        `xml:"text,omitempty"`
 	Identifier []Identifier      `xml:"identifier"`
 	Status     Text              `xml:"status"`
 	Category   []CodeableConcept `xml:"category,omitempty"`
@@ -439,11 +744,28 @@ type Observation struct {
 	Performer         []struct {
 		Reference Reference `xml:"reference"`
 	} `xml:"performer"`
-	BodySite             *CodeableConcept          `xml:"bodySite,omitempty"`
+	// value[x] precedes bodySite in the STU3 element order
 	ValueQuantity        *ValueQuantity            `xml:"valueQuantity,omitempty"`
 	ValueCodeableConcept *CodeableConcept          `xml:"valueCodeableConcept,omitempty"`
+	ValueString          *Text                     `xml:"valueString,omitempty"`
+	ValueBoolean         *Text                     `xml:"valueBoolean,omitempty"`
+	ValuePeriod          *ValuePeriod              `xml:"valuePeriod,omitempty"`
+	Interpretation       *CodeableConcept          `xml:"interpretation,omitempty"`
+	BodySite             *CodeableConcept          `xml:"bodySite,omitempty"`
+	ReferenceRange       []ReferenceRange          `xml:"referenceRange,omitempty"`
 	Component            []ObservationComponentXML `xml:"component,omitempty"`
 }
+type ReferenceRange struct {
+	XMLName xml.Name  `xml:"referenceRange"`
+	Low     *Quantity `xml:"low,omitempty"`
+	High    *Quantity `xml:"high,omitempty"`
+	Text    *Text     `xml:"text,omitempty"`
+}
+type ValuePeriod struct {
+	XMLName xml.Name `xml:"valuePeriod"`
+	Start   *Text    `xml:"start,omitempty"`
+	End     *Text    `xml:"end,omitempty"`
+}
 type ValueQuantity struct {
 	XMLName xml.Name `xml:"valueQuantity"`
 	Value   *Text    `xml:"value,omitempty"`
@@ -457,16 +779,20 @@ type ObservationComponentXML struct {
 	Code                 CodeableConcept  `xml:"code"`
 	ValueQuantity        *ValueQuantity   `xml:"valueQuantity,omitempty"`
 	ValueCodeableConcept *CodeableConcept `xml:"valueCodeableConcept,omitempty"`
+	Interpretation       *CodeableConcept `xml:"interpretation,omitempty"`
+	ReferenceRange       []ReferenceRange `xml:"referenceRange,omitempty"`
 }
 
 /* ---- ClinicalImpression ---- */
 
 type ClinicalImpression struct {
-	XMLName    xml.Name     `xml:"ClinicalImpression"`
-	ID         Attr         `xml:"id"`
-	Meta       Meta         `xml:"meta"`
-	Identifier []Identifier `xml:"identifier"`
-	Status     Text         `xml:"status"`
+	XMLName    xml.Name         `xml:"ClinicalImpression"`
+	ID         Attr             `xml:"id"`
+	Meta       Meta             `xml:"meta"`
+	Text       *Narrative       `xml:"text,omitempty"`
+	Identifier []Identifier     `xml:"identifier"`
+	Status     Text             `xml:"status"`
+	Code       *CodeableConcept `xml:"code,omitempty"` // Record Standard Heading
 	Subject    struct {
 		Reference Reference `xml:"reference"`
 	} `xml:"subject"`
@@ -480,34 +806,13 @@ type ClinicalImpression struct {
 	Summary Text `xml:"summary"`
 }
 
-/* ---- DocumentReference (simple) ---- */
-
-type DocumentReference struct {
-	XMLName xml.Name `xml:"DocumentReference"`
-	ID      Attr     `xml:"id"`
-	Meta    Meta     `xml:"meta"`
-	Status  Text     `xml:"status"`
-	Subject struct {
-		Reference Reference `xml:"reference"`
-	} `xml:"subject"`
-	Content []struct {
-		XMLName    xml.Name `xml:"content"`
-		Attachment struct {
-			XMLName     xml.Name `xml:"attachment"`
-			ContentType Text     `xml:"contentType"`
-			Title       *Text    `xml:"title,omitempty"`
-			Data        Text     `xml:"data"`
-		} `xml:"attachment"`
-	} `xml:"content"`
-	Description *Text `xml:"description,omitempty"`
-}
-
 // MedicationDispense represents a FHIR STU3 MedicationDispense resource
 // using the same XML conventions as your other resources.
 type MedicationDispense struct {
 	XMLName                   xml.Name         `xml:"MedicationDispense"`
 	ID                        Attr             `xml:"id"`
 	Meta                      Meta             `xml:"meta"`
+	Text                      *Narrative       `xml:"text,omitempty"`
 	Identifier                Identifier       `xml:"identifier"`
 	Status                    Text             `xml:"status"` // completed | in-progress etc.
 	Category                  *CodeableConcept `xml:"category,omitempty"`
@@ -525,6 +830,7 @@ type MedicationDispense struct {
 	WhenPrepared      *Text                         `xml:"whenPrepared,omitempty"`
 	WhenHandedOver    *Text                         `xml:"whenHandedOver,omitempty"`
 	DosageInstruction []MedicationDosageInstruction `xml:"dosageInstruction,omitempty"`
+	NotDone           *Text                         `xml:"notDone,omitempty"`
 }
 
 // Generic quantity: element name comes from the field tag (e.g. xml:"numerator")
@@ -575,9 +881,9 @@ type Timing struct {
 }
 
 type TimingRepeat struct {
-	Frequency  *int    `xml:"frequency,omitempty"`
-	Period     float32 `xml:"period,omitempty"`
-	PeriodUnit *Text   `xml:"periodUnit,omitempty"`
+	Frequency  *Text `xml:"frequency,omitempty"`
+	Period     *Text `xml:"period,omitempty"`
+	PeriodUnit *Text `xml:"periodUnit,omitempty"`
 }
 
 // Ratio is used for maxDosePerPeriod
@@ -588,7 +894,7 @@ type Ratio struct {
 
 /* ------------ builders ------------- */
 
-func makeMessageHeader(id, docBundleID, orgID string, cfg Config, opts *http.MessageHeaderOptions, lastUpdated string) MessageHeader {
+func makeMessageHeader(id, docBundleID, orgID string, event MessageEvent, profile string, cfg Config, sys http.SystemProvenance, opts *http.MessageHeaderOptions, lastUpdated string) MessageHeader {
 	bus := cfg.DefaultBusinessAckRequested
 	inf := cfg.DefaultInfrastructureAckRequested
 	rec := cfg.DefaultRecipientType
@@ -647,34 +953,33 @@ func makeMessageHeader(id, docBundleID, orgID string, cfg Config, opts *http.Mes
 
 	h := MessageHeader{
 		ID:        Attr{Value: trimURN(id)},
-		Meta:      Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.nhs.uk/STU3/StructureDefinition/ITK-MessageHeader-2"}},
+		Meta:      Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: profile}},
 		Extension: []MHOuterExtension{ext},
 		Event: CodingEvent{
 			System:  Attr{Value: "https://fhir.nhs.uk/STU3/CodeSystem/ITK-MessageEvent-2"},
-			Code:    Attr{Value: "ITK014M"},
-			Display: Attr{Value: "ITK Update Record"},
+			Code:    Attr{Value: event.Code},
+			Display: Attr{Value: event.Display},
 		},
-		Timestamp: Text{Value: time.Now().Format(time.RFC3339Nano)},
+		Timestamp: Text{Value: lastUpdated},
 	}
 	h.Sender.Reference = Reference{RefValue: idRef(orgID)}
+	if sys.Asid != nil && strings.TrimSpace(*sys.Asid) != "" {
+		h.Source.Extension = []SourceExtension{{
+			URL:             sourceASIDExtension,
+			ValueIdentifier: &ValueIdentifier{System: Attr{Value: asidSystem}, Value: Attr{Value: strings.TrimSpace(*sys.Asid)}},
+		}}
+	}
+	h.Source.Name = optText(sys.Name)
+	h.Source.Software = optTextPtr(sys.Software)
+	h.Source.Version = optTextPtr(sys.Version)
 	h.Source.Endpoint = Attr{Value: cfg.SenderMeshMailbox}
 	h.Focus.Reference = Reference{RefValue: idRef(docBundleID)}
 	return h
 }
 
-func makeOrganization(id, profile, ods, lastUpdated string) Organization {
-	return Organization{
-		ID:   Attr{Value: trimURN(id)},
-		Meta: Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: profile}},
-		Identifier: []Identifier{
-			{System: Attr{Value: "https://fhir.nhs.uk/Id/ods-organization-code"}, Value: Attr{Value: ods}},
-		},
-	}
-}
-
 func makePatient(id string, p http.Patient, lastUpdated string) PatientXML {
 	ids := []Identifier{
-		{System: Attr{Value: "https://fhir.nhs.uk/Id/nhs-number"}, Value: Attr{Value: p.NhsNumber}},
+		{System: Attr{Value: nhsNumberSystem}, Value: Attr{Value: p.NhsNumber}},
 	}
 	// NHS number verification extension (simplified; attached as separate identifier extension is omitted)
 	name := HumanName{
@@ -704,29 +1009,11 @@ func makePatient(id string, p http.Patient, lastUpdated string) PatientXML {
 }
 
 func makePractitioner(id string, a http.Author, lastUpdated string) Practitioner {
-	ids := []Identifier{}
-	if a.Identifiers != nil {
-		for _, i := range *a.Identifiers {
-			ids = append(ids, Identifier{System: Attr{Value: i.System}, Value: Attr{Value: i.Value}})
-		}
-	}
-
-	if a.ProfessionalCode != nil {
-		ids = append(ids, Identifier{System: Attr{Value: "https://fhir.provider.example/identifier/staff-code"}, Value: Attr{Value: *a.ProfessionalCode}})
-	}
-	prefix, given, family := splitName(a.Name)
-	name := HumanName{Family: Text{Value: family}}
-	if given != "" {
-		name.Given = []Text{{Value: given}}
-	}
-	if prefix != "" {
-		name.Prefix = []Text{{Value: prefix}}
-	}
 	return Practitioner{
 		ID:         Attr{Value: trimURN(id)},
 		Meta:       Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-GPC-Practitioner-1"}},
-		Identifier: ids,
-		Name:       []HumanName{name},
+		Identifier: practitionerIdentifiers(a),
+		Name:       []HumanName{practitionerName(a)},
 	}
 }
 
@@ -741,17 +1028,17 @@ func makePractitionerRole(id, prID, orgID string, role http.CodeableConcept, las
 			Reference Reference `xml:"reference"`
 		}{Reference: Reference{RefValue: idRef(orgID)}},
 		Code: CodeableConcept{
-			Coding: []Coding{{System: Attr{Value: role.System}, Code: Attr{Value: role.Code} /*Display: optText(*role.Display)*/}},
-			Text:   optText(*role.Display),
+			Coding: []Coding{{System: Attr{Value: role.System}, Code: Attr{Value: role.Code}, Display: optAttr(role.Display)}},
+			Text:   optTextPtr(role.Display),
 		},
 	}
 }
 
-func makeEncounter(id string, e http.Encounter, patientID, practitionerID, orgID, lastUpdated string) EncounterXML {
+func makeEncounter(id string, ident Identifier, e http.Encounter, patientID string, participants []EncounterParticipant, orgID, lastUpdated string) EncounterXML {
 	out := EncounterXML{
 		ID:         Attr{Value: trimURN(id)},
 		Meta:       Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-GPC-Encounter-1"}},
-		Identifier: []Identifier{{System: Attr{Value: "https://fhir.provider.example/identifier/encounter"}, Value: Attr{Value: trimURN(id)}}},
+		Identifier: []Identifier{ident},
 		Status:     Text{Value: "finished"},
 		Type: []CodeableConcept{{
 			Coding: []Coding{{System: Attr{Value: "http://snomed.info/sct"}, Code: Attr{Value: "307778003"} /*Display: optText("Seen in primary care establishment")*/}},
@@ -760,26 +1047,34 @@ func makeEncounter(id string, e http.Encounter, patientID, practitionerID, orgID
 		Subject: struct {
 			Reference Reference `xml:"reference"`
 		}{Reference: Reference{RefValue: idRef(patientID)}},
-		Participant: []EncounterParticipant{{
-			Type: []CodeableConcept{{
-				Coding: []Coding{{System: Attr{Value: "https://fhir.nhs.uk/STU3/CodeSystem/GPConnect-ParticipantType-1"}, Code: Attr{Value: "REC"}}},
-				Text:   optText("recorder"),
-			}},
-			Individual: struct {
-				Reference Reference `xml:"reference"`
-			}{Reference: Reference{RefValue: idRef(practitionerID)}},
-		}},
+		Participant: participants,
 		ServiceProvider: struct {
 			Reference Reference `xml:"reference"`
 		}{Reference: Reference{RefValue: idRef(orgID)}},
 	}
 	if e.OccurredAt != nil {
-		out.Period = &Period{Start: Text{Value: e.OccurredAt.Format("2006-01-02")}}
+		out.Period = &Period{Start: Text{Value: fhirDateTime(*e.OccurredAt)}}
+		end := e.EndedAt
+		if end == nil && e.DurationMinutes != nil {
+			t := e.OccurredAt.Add(time.Duration(*e.DurationMinutes) * time.Minute)
+			end = &t
+		}
+		if end != nil {
+			out.Period.End = &Text{Value: fhirDateTime(*end)}
+		}
+		minutes := e.DurationMinutes
+		if minutes == nil && end != nil {
+			m := int(end.Sub(*e.OccurredAt).Round(time.Minute) / time.Minute)
+			minutes = &m
+		}
+		if minutes != nil {
+			out.Length = quantity(ucumQuantity(json.Number(strconv.Itoa(*minutes)), "minute", "min"))
+		}
 	}
 	if e.ReasonCode != nil && e.ReasonCode.System != "" && e.ReasonCode.Code != "" {
 		out.Reason = []CodeableConcept{{
-			Coding: []Coding{{System: Attr{Value: e.ReasonCode.System}, Code: Attr{Value: e.ReasonCode.Code} /*Display: optText(e.ReasonCode.Display)*/}},
-			Text:   optText(*e.ReasonCode.Display),
+			Coding: []Coding{{System: Attr{Value: e.ReasonCode.System}, Code: Attr{Value: e.ReasonCode.Code}, Display: optAttr(e.ReasonCode.Display)}},
+			Text:   optTextPtr(e.ReasonCode.Display),
 		}}
 	} else if e.Reason != nil {
 		out.Reason = []CodeableConcept{{
@@ -800,73 +1095,47 @@ func makeEncounter(id string, e http.Encounter, patientID, practitionerID, orgID
 	return out
 }
 
-func makeComposition(id string, req http.UpdateRecordRequest, patientID, encounterID, authorID, lastUpdated string) Composition {
+func makeComposition(id, profile string, ident Identifier, req http.UpdateRecordRequest, patientID, encounterID string, authorIDs []string, sections []CompositionSection, lastUpdated string) Composition {
 	cc := codedOrDefault(req.Composition)
-	section := struct {
-		XMLName xml.Name `xml:"section"`
-		Entry   []struct {
-			Reference Reference `xml:"reference"`
-		} `xml:"entry"`
-	}{}
-
-	refsInOrder := []string{
-		"urn:uuid:e9a3673b-12d2-4001-826f-626e30d5f71e",
-		"urn:uuid:62db03c2-148b-4872-8d8b-2ea19871c00d",
-		"urn:uuid:c11ba114-d1bf-461c-a5ee-10e82df9dcc8",
-		"urn:uuid:75c5672f-b2d6-435f-80c8-a4864258162b",
-		"urn:uuid:c33b855b-4824-4876-9509-ed34de2109b4",
-		"urn:uuid:e7c459a8-2f3f-4968-aa37-937e0a0b88dd",
-		"urn:uuid:0843a500-9f0c-4043-bfd8-b03ca0e95735",
-		"urn:uuid:cb8e1553-4bf1-474c-ab42-f70219b1545a",
-		"urn:uuid:3ecca922-9841-43b6-8389-edc4936228dd",
-	}
-	for _, r := range refsInOrder {
-		section.Entry = append(section.Entry, struct {
-			Reference Reference `xml:"reference"`
-		}{Reference: Reference{RefValue: r}})
-	}
-
-	// We’ll include references to all entries present later by consumers—here we leave it empty (optional), or you can populate if you collected refs.
-	return Composition{
+	comp := Composition{
 		ID:         Attr{Value: trimURN(id)},
-		Meta:       Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.hl7.org.uk/STU3/StructureDefinition/CareConnect-Composition-1"}},
-		Identifier: Identifier{System: Attr{Value: "https://fhir.provider.example/identifier/composition"}, Value: Attr{Value: trimURN(id)}},
+		Meta:       Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: profile}},
+		Identifier: ident,
 		Status:     Text{Value: "final"},
-		Type:       CodeableConcept{Coding: []Coding{{System: Attr{Value: cc.System}, Code: Attr{Value: cc.Code}, Display: optAttr(cc.Display)}}, Text: optText(*cc.Display)},
+		Type:       CodeableConcept{Coding: []Coding{{System: Attr{Value: cc.System}, Code: Attr{Value: cc.Code}, Display: optAttr(cc.Display)}}, Text: optTextPtr(cc.Display)},
 		Subject: struct {
 			Reference Reference `xml:"reference"`
 		}{Reference: Reference{RefValue: idRef(patientID)}},
 		Encounter: struct {
 			Reference Reference `xml:"reference"`
 		}{Reference: Reference{RefValue: idRef(encounterID)}},
-		Date: Text{Value: time.Now().Format("2006-01-02")},
-		Author: []struct {
+		Date:    Text{Value: lastUpdated},
+		Title:   Text{Value: compositionTitle(req.Composition)},
+		Section: sections,
+	}
+	for _, a := range authorIDs {
+		comp.Author = append(comp.Author, struct {
 			Reference Reference `xml:"reference"`
-		}{{Reference: Reference{RefValue: idRef(authorID)}}},
-		Title: Text{Value: defaultString(req.Composition != nil && *req.Composition.Title != "", *req.Composition.Title, "Community service update")},
-		Section: []struct {
-			XMLName xml.Name `xml:"section"`
-			Entry   []struct {
-				Reference Reference `xml:"reference"`
-			} `xml:"entry"`
-		}{section},
+		}{Reference: Reference{RefValue: idRef(a)}})
 	}
+	return comp
 }
 
-func defaultString(cond bool, a, b string) string {
-	if cond {
-		return a
+// compositionTitle is the client's title, or a generic one.
+func compositionTitle(cd *http.CompositionDetails) string {
+	if cd != nil && cd.Title != nil && strings.TrimSpace(*cd.Title) != "" {
+		return *cd.Title
 	}
-	return b
+	return "Community service update"
 }
 
-func makeObservation(id string, ob http.ObservationInput, patientID, encounterID, performerID, lastUpdated string) Observation {
+func makeObservation(id string, ident Identifier, ob http.ObservationInput, patientID, encounterID, performerID, lastUpdated string) Observation {
 	obs := Observation{
 		ID:         Attr{Value: trimURN(id)},
 		Meta:       Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-GPC-Observation-1"}},
-		Identifier: []Identifier{{System: Attr{Value: "https://fhir.provider.example/identifier/observation"}, Value: Attr{Value: trimURN(id)}}},
+		Identifier: []Identifier{ident},
 		Status:     Text{Value: "final"},
-		Code:       CodeableConcept{Coding: []Coding{{System: Attr{Value: ob.Code.Code}, Code: Attr{Value: ob.Code.Code}, Display: optAttr(ob.Code.Display)}}, Text: optText(*ob.Code.Text)},
+		Code:       codedToCC(ob.Code),
 		Subject: struct {
 			Reference Reference `xml:"reference"`
 		}{Reference: Reference{RefValue: idRef(patientID)}},
@@ -881,50 +1150,67 @@ func makeObservation(id string, ob http.ObservationInput, patientID, encounterID
 	if ob.Category != nil && ob.Category.System != "" && ob.Category.Code != "" {
 		obs.Category = []CodeableConcept{{
 			Coding: []Coding{{System: Attr{Value: ob.Category.System}, Code: Attr{Value: ob.Category.Code}, Display: optAttr(ob.Category.Display)}},
-			Text:   optText(*ob.Category.Display),
+			Text:   optTextPtr(ob.Category.Display),
 		}}
 	} else if ob.Category != nil {
 		obs.Category = []CodeableConcept{{
 			Coding: []Coding{{System: Attr{Value: "http://terminology.hl7.org/CodeSystem/observation-category"}, Code: Attr{Value: ob.Category.Code}}},
-			Text:   optText(*ob.Category.Text),
+			Text:   optTextPtr(ob.Category.Text),
 		}}
 	}
 	// timing
 	if !ob.EffectiveDateTime.IsZero() {
-		obs.EffectiveDateTime = &Text{Value: ob.EffectiveDateTime.Format("2006-01-02")}
+		obs.EffectiveDateTime = &Text{Value: fhirDateTime(ob.EffectiveDateTime)}
 	}
 	if ob.Issued != nil {
-		obs.Issued = &Text{Value: ob.Issued.Format(time.RFC3339Nano)}
+		obs.Issued = &Text{Value: fhirDateTime(*ob.Issued)}
 	}
 	// bodySite
 	if ob.BodySite != nil && ob.BodySite.System != "" && ob.BodySite.Code != "" {
-		obs.BodySite = &CodeableConcept{Coding: []Coding{{System: Attr{Value: ob.BodySite.System}, Code: Attr{Value: ob.BodySite.Code} /*Display: optText(ob.BodySite.Display)*/}}, Text: optText(*ob.BodySite.Display)}
+		obs.BodySite = &CodeableConcept{Coding: []Coding{{System: Attr{Value: ob.BodySite.System}, Code: Attr{Value: ob.BodySite.Code} /*Display: optText(ob.BodySite.Display)*/}}, Text: optTextPtr(ob.BodySite.Display)}
 	}
-	// values
-	// todo
-	/*switch {
+	// value[x] (validateObservations guarantees at most one is set)
+	switch {
 	case ob.ValueQuantity != nil:
 		obs.ValueQuantity = qToXML(*ob.ValueQuantity)
 	case ob.ValueCodeableConcept != nil:
-		obs.ValueCodeableConcept = &CodeableConcept{Coding: []Coding{{System: Attr{Value: ob.ValueCodeableConcept.System}, Code: Attr{Value: ob.ValueCodeableConcept.Code} /*Display: optText(ob.ValueCodeableConcept.Display)}}, Text: optText(*ob.ValueCodeableConcept.Display)}*/
-	/*case ob.Value != nil:
-		obs.ValueQuantity = &ValueQuantity{
-			Value: &Text{Value: *ob.Value},
-			Unit:  optText(*ob.Unit),
+		cc := codedToCC(*ob.ValueCodeableConcept)
+		obs.ValueCodeableConcept = &cc
+	case ob.ValueString != nil:
+		obs.ValueString = &Text{Value: *ob.ValueString}
+	case ob.ValueBoolean != nil:
+		obs.ValueBoolean = &Text{Value: strconv.FormatBool(*ob.ValueBoolean)}
+	case ob.ValuePeriod != nil:
+		obs.ValuePeriod = &ValuePeriod{}
+		if ob.ValuePeriod.Start != nil {
+			obs.ValuePeriod.Start = &Text{Value: fhirDateTime(*ob.ValuePeriod.Start)}
+		}
+		if ob.ValuePeriod.End != nil {
+			obs.ValuePeriod.End = &Text{Value: fhirDateTime(*ob.ValuePeriod.End)}
 		}
-	}*/
+	}
+	if ob.Interpretation != nil {
+		cc := codedToCC(*ob.Interpretation)
+		obs.Interpretation = &cc
+	}
+	obs.ReferenceRange = rangesToXML(ob.ReferenceRange)
 	// components
 	if ob.Components != nil {
 		for _, c := range *ob.Components {
 			comp := ObservationComponentXML{
-				Code: CodeableConcept{Coding: []Coding{{System: Attr{Value: c.Code.System}, Code: Attr{Value: c.Code.Code} /*Display: optText(c.Code.Display)*/}}, Text: optText(*c.Code.Display)},
+				Code: CodeableConcept{Coding: []Coding{{System: Attr{Value: c.Code.System}, Code: Attr{Value: c.Code.Code} /*Display: optText(c.Code.Display)*/}}, Text: optTextPtr(c.Code.Display)},
 			}
 			if c.ValueQuantity != nil {
 				comp.ValueQuantity = qToXML(*c.ValueQuantity)
 			}
 			if c.ValueCodeableConcept != nil {
-				comp.ValueCodeableConcept = &CodeableConcept{Coding: []Coding{{System: Attr{Value: c.ValueCodeableConcept.System}, Code: Attr{Value: c.ValueCodeableConcept.Code} /*Display: optText(c.ValueCodeableConcept.Display)*/}}, Text: optText(*c.ValueCodeableConcept.Display)}
+				comp.ValueCodeableConcept = &CodeableConcept{Coding: []Coding{{System: Attr{Value: c.ValueCodeableConcept.System}, Code: Attr{Value: c.ValueCodeableConcept.Code} /*Display: optText(c.ValueCodeableConcept.Display)*/}}, Text: optTextPtr(c.ValueCodeableConcept.Display)}
 			}
+			if c.Interpretation != nil {
+				cc := codedToCC(*c.Interpretation)
+				comp.Interpretation = &cc
+			}
+			comp.ReferenceRange = rangesToXML(c.ReferenceRange)
 			obs.Component = append(obs.Component, comp)
 		}
 	}
@@ -932,20 +1218,21 @@ func makeObservation(id string, ob http.ObservationInput, patientID, encounterID
 	return obs
 }
 
-func makeClinicalImpression(id string, nb http.NarrativeBlock, patientID, encID, assessorID, lastUpdated string) ClinicalImpression {
+func makeClinicalImpression(id string, ident Identifier, nb http.NarrativeBlock, patientID, encID, assessorID, lastUpdated string) ClinicalImpression {
 	meta := Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-GPC-ClinicalImpression-1"}}
 	return ClinicalImpression{
 		ID:         Attr{Value: trimURN(id)},
 		Meta:       meta,
-		Identifier: []Identifier{{System: Attr{Value: "https://fhir.provider.example/identifier/clinical-impression"}, Value: Attr{Value: trimURN(id)}}},
+		Identifier: []Identifier{ident},
 		Status:     Text{Value: "completed"},
+		Code:       headingCC(nb.HeadingCode),
 		Subject: struct {
 			Reference Reference `xml:"reference"`
 		}{Reference: Reference{RefValue: idRef(patientID)}},
 		Context: struct {
 			Reference Reference `xml:"reference"`
 		}{Reference: Reference{RefValue: idRef(encID)}},
-		Date: Text{Value: time.Now().Format("2006-01-02")},
+		Date: Text{Value: lastUpdated},
 		Assessor: struct {
 			Reference Reference `xml:"reference"`
 		}{Reference: Reference{RefValue: idRef(assessorID)}},
@@ -953,61 +1240,27 @@ func makeClinicalImpression(id string, nb http.NarrativeBlock, patientID, encID,
 	}
 }
 
-func makeDocumentReference(id string, att http.Attachment, patientID, lastUpdated string) DocumentReference {
-	dr := DocumentReference{
-		ID:     Attr{Value: trimURN(id)},
-		Meta:   Meta{LastUpdated: Attr{Value: lastUpdated}},
-		Status: Text{Value: "current"},
-		Subject: struct {
-			Reference Reference `xml:"reference"`
-		}{Reference: Reference{RefValue: idRef(patientID)}},
-		Description: optText(*att.Description),
-	}
-	var c struct {
-		XMLName    xml.Name `xml:"content"`
-		Attachment struct {
-			XMLName     xml.Name `xml:"attachment"`
-			ContentType Text     `xml:"contentType"`
-			Title       *Text    `xml:"title,omitempty"`
-			Data        Text     `xml:"data"`
-		} `xml:"attachment"`
-	}
-	c.Attachment.ContentType = Text{Value: att.ContentType}
-	if att.Title != nil {
-		c.Attachment.Title = &Text{Value: *att.Title}
-	}
-	c.Attachment.Data = Text{Value: att.Base64}
-	dr.Content = []struct {
-		XMLName    xml.Name `xml:"content"`
-		Attachment struct {
-			XMLName     xml.Name `xml:"attachment"`
-			ContentType Text     `xml:"contentType"`
-			Title       *Text    `xml:"title,omitempty"`
-			Data        Text     `xml:"data"`
-		} `xml:"attachment"`
-	}{c}
-	return dr
-}
-
 // makeMedicationDispense builds a MedicationDispense entry and returns the entry plus its urn:uuid
 func makeMedicationDispense(
+	mdID string,
+	ident Identifier,
 	ms http.MedicationSupplied,
 	patientID, encounterID, authorID string,
 	lastUpdated string,
-) (Entry, string) {
+) Entry {
 
-	mdID := newURN() // your helper returning "urn:uuid:...."
 	res := MedicationDispense{
 		ID: Attr{Value: trimURN(mdID)},
 		Meta: Meta{
 			LastUpdated: Attr{Value: lastUpdated},
 			Profile:     Attr{Value: "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-GPC-MedicationDispense-1"},
 		},
-		Identifier: Identifier{
-			System: Attr{Value: "https://fhir.provider.example/identifier/medication-dispense"},
-			Value:  Attr{Value: trimURN(mdID)},
-		},
-		//Status: Text{Value: defaultString(ms.Status, "completed")},
+		Identifier: ident,
+	}
+	status, notDone, _ := dispenseStatus(ms.Status) // validateMedications rejects unmappable statuses
+	res.Status = Text{Value: status}
+	if notDone {
+		res.NotDone = &Text{Value: "true"}
 	}
 
 	// Category (optional)
@@ -1018,7 +1271,7 @@ func makeMedicationDispense(
 				Code:    Attr{Value: ms.Category.Code},
 				Display: optAttr(ms.Category.Display),
 			}},
-			Text: optText(*ms.Category.Display),
+			Text: optTextPtr(ms.Category.Display),
 		}
 		res.Category = &mdCat
 	}
@@ -1030,7 +1283,7 @@ func makeMedicationDispense(
 			Code:    Attr{Value: ms.Medication.Code},
 			Display: optAttr(ms.Medication.Display),
 		}},
-		Text: optText(*ms.Medication.Display),
+		Text: optTextPtr(ms.Medication.Display),
 	}
 
 	// Subject / Context / Performer
@@ -1054,23 +1307,23 @@ func makeMedicationDispense(
 				Code:    Attr{Value: ms.SupplyType.Code},
 				Display: optAttr(ms.SupplyType.Display),
 			}},
-			Text: optText(*ms.SupplyType.Display),
+			Text: optTextPtr(ms.SupplyType.Display),
 		}
 	}
 
 	// Quantity / DaysSupply (optional)
 	if ms.Quantity != nil {
 		res.Quantity = &QuantityXML{
-			Value:  optText(fmt.Sprintf("%.0f", ms.Quantity.Value)),
-			Unit:   optText(*ms.Quantity.Unit),
+			Value:  &Text{Value: decimal(ms.Quantity.Value)},
+			Unit:   optTextPtr(ms.Quantity.Unit),
 			System: optAttr(ms.Quantity.System),
 			Code:   optAttr(ms.Quantity.Code),
 		}
 	}
 	if ms.DaysSupply != nil {
 		res.DaysSupply = &DaysSupplyXML{
-			Value:  optText(fmt.Sprintf("%.0f", ms.DaysSupply.Value)),
-			Unit:   optText(*ms.DaysSupply.Unit),
+			Value:  &Text{Value: decimal(ms.DaysSupply.Value)},
+			Unit:   optTextPtr(ms.DaysSupply.Unit),
 			System: optAttr(ms.DaysSupply.System),
 			Code:   optAttr(ms.DaysSupply.Code),
 		}
@@ -1087,17 +1340,16 @@ func makeMedicationDispense(
 	// DosageInstruction (optional)
 	if ms.DosageInstruction != nil {
 		di := MedicationDosageInstruction{
-			Text:               optText(*ms.DosageInstruction.Text),
-			PatientInstruction: optText(*ms.DosageInstruction.PatientInstruction),
+			Text:               optTextPtr(ms.DosageInstruction.Text),
+			PatientInstruction: optTextPtr(ms.DosageInstruction.PatientInstruction),
 		}
 		if ms.DosageInstruction.Timing != nil {
-			di.Timing = &Timing{
-				Repeat: &TimingRepeat{
-					Frequency:  ms.DosageInstruction.Timing.Frequency,
-					Period:     *ms.DosageInstruction.Timing.Period,
-					PeriodUnit: optText(*ms.DosageInstruction.Timing.PeriodUnit),
-				},
+			t := ms.DosageInstruction.Timing
+			repeat := &TimingRepeat{Period: optDecimal(t.Period), PeriodUnit: optTextPtr(t.PeriodUnit)}
+			if t.Frequency != nil {
+				repeat.Frequency = &Text{Value: strconv.Itoa(*t.Frequency)}
 			}
+			di.Timing = &Timing{Repeat: repeat}
 		}
 		if ms.DosageInstruction.Route != nil {
 			di.Route = &CodeableConcept{
@@ -1106,20 +1358,20 @@ func makeMedicationDispense(
 					Code:    Attr{Value: ms.DosageInstruction.Route.Code},
 					Display: optAttr(ms.DosageInstruction.Route.Display),
 				}},
-				Text: optText(*ms.DosageInstruction.Route.Display),
+				Text: optTextPtr(ms.DosageInstruction.Route.Display),
 			}
 		}
 		if mdp := ms.DosageInstruction.MaxDosePerPeriod; mdp != nil {
 			di.MaxDosePerPeriod = &Ratio{
 				Numerator: &Quantity{
 					Value:  optDecimal(&mdp.Numerator.Value),
-					Unit:   optText(*mdp.Numerator.Unit),
+					Unit:   optTextPtr(mdp.Numerator.Unit),
 					System: optAttr(mdp.Numerator.System),
 					Code:   optAttr(mdp.Numerator.Code),
 				},
 				Denominator: &Quantity{
 					Value:  optDecimal(&mdp.Denominator.Value),
-					Unit:   optText(*mdp.Denominator.Unit),
+					Unit:   optTextPtr(mdp.Denominator.Unit),
 					System: optAttr(mdp.Denominator.System),
 					Code:   optAttr(mdp.Denominator.Code),
 				},
@@ -1127,16 +1379,55 @@ func makeMedicationDispense(
 		}
 		res.DosageInstruction = []MedicationDosageInstruction{di}
 	}
+	res.Text = medicationDispenseNarrative(res)
 
 	entry := Entry{
 		FullURL:  mdID,
 		Resource: EntryResource{MedicationDispense: &res},
 	}
-	return entry, mdID
+	return entry
 }
 
 /* ------------ utils ------------- */
 
+// SenderODS is the performer ODS code named in the request: the primary
+// encounter's when there is one, else the single encounter's. It is empty
+// when the request names none.
+func SenderODS(req http.UpdateRecordRequest) string {
+	if req.Encounters != nil {
+		for _, e := range *req.Encounters {
+			if e.Role != nil && *e.Role == "primary" && e.PerformerODS != nil {
+				return strings.TrimSpace(*e.PerformerODS)
+			}
+		}
+	}
+	if req.Encounter != nil && req.Encounter.PerformerODS != nil {
+		return strings.TrimSpace(*req.Encounter.PerformerODS)
+	}
+	return ""
+}
+
+// applySenderASID fills provenance.system.asid from the sender's configured
+// ASID, and rejects a request claiming a different one.
+func applySenderASID(req http.UpdateRecordRequest, asid string) (http.UpdateRecordRequest, error) {
+	if asid == "" {
+		return req, nil
+	}
+	sys := http.SystemProvenance{}
+	if req.Provenance.System != nil {
+		sys = *req.Provenance.System
+	}
+	if sys.Asid != nil && strings.TrimSpace(*sys.Asid) != "" {
+		if strings.TrimSpace(*sys.Asid) != asid {
+			return req, fmt.Errorf("provenance.system.asid %q does not match the sender's ASID", *sys.Asid)
+		}
+		return req, nil
+	}
+	sys.Asid = &asid
+	req.Provenance.System = &sys
+	return req, nil
+}
+
 func validateMinimal(req http.UpdateRecordRequest) error {
 	if strings.TrimSpace(req.Patient.NhsNumber) == "" ||
 		strings.TrimSpace(req.Patient.DateOfBirth.String()) == "" ||
@@ -1147,29 +1438,192 @@ func validateMinimal(req http.UpdateRecordRequest) error {
 		return errors.New("clinicalSummary.freeText is required")
 	}
 	if strings.TrimSpace(req.Provenance.Author.Name) == "" ||
-		req.Provenance.System.Asid == nil ||
+		req.Provenance.System == nil || req.Provenance.System.Asid == nil || strings.TrimSpace(*req.Provenance.System.Asid) == "" ||
 		strings.TrimSpace(req.Provenance.System.Name) == "" {
 		return errors.New("provenance.author.name and provenance.system.{asid,name} are required")
 	}
 	if strings.TrimSpace(req.Routing.RegisteredPracticeODS) == "" {
 		return errors.New("routing.registeredPracticeODS is required")
 	}
+	// refused rather than dropped, so a sender never believes a document went
+	if req.Attachments != nil && len(*req.Attachments) > 0 {
+		return errors.New("attachments are not supported yet")
+	}
+	return nil
+}
+
+// validateEncounters checks there is at most one primary encounter, that
+// encounter IDs are unique and every context reference names one of them,
+// and that end times and durations agree with the start.
+func validateEncounters(req http.UpdateRecordRequest) error {
+	if req.Encounter != nil {
+		if err := validateEncounterTiming("encounter", *req.Encounter); err != nil {
+			return err
+		}
+	}
+	var encounters []http.EncounterWithRole
+	if req.Encounters != nil {
+		encounters = *req.Encounters
+	}
+	primaries := 0
+	seen := map[string]bool{}
+	for i, e := range encounters {
+		enc, _ := toEncounter(e)
+		if err := validateEncounterTiming(fmt.Sprintf("encounters[%d]", i), enc.Encounter); err != nil {
+			return err
+		}
+		if e.Role != nil && *e.Role == "primary" {
+			primaries++
+		}
+		if e.Id == nil {
+			continue
+		}
+		if seen[*e.Id] {
+			return fmt.Errorf("encounters[%d].id %q is not unique", i, *e.Id)
+		}
+		seen[*e.Id] = true
+	}
+	if primaries > 1 {
+		return errors.New("only one encounter may have role primary")
+	}
+	return validateEncounterRefs(req, seen)
+}
+
+// validateEncounterRefs rejects context references to encounters that
+// weren't sent; an absent reference means the primary encounter.
+func validateEncounterRefs(req http.UpdateRecordRequest, known map[string]bool) error {
+	var problems []string
+	check := func(field string, ref *string) {
+		if ref != nil && *ref != "" && !known[*ref] {
+			problems = append(problems, fmt.Sprintf("%s.contextEncounterRef %q is not an encounters[].id", field, *ref))
+		}
+	}
+	if req.Observations != nil {
+		for i, ob := range *req.Observations {
+			check(fmt.Sprintf("observations[%d]", i), &ob.ContextEncounterRef)
+		}
+	}
+	if req.Procedures != nil {
+		for i, p := range *req.Procedures {
+			check(fmt.Sprintf("procedures[%d]", i), p.ContextEncounterRef)
+		}
+	}
+	if req.Immunizations != nil {
+		for i, im := range *req.Immunizations {
+			check(fmt.Sprintf("immunizations[%d]", i), im.ContextEncounterRef)
+		}
+	}
+	if req.Referrals != nil {
+		for i, r := range *req.Referrals {
+			check(fmt.Sprintf("referrals[%d]", i), r.ContextEncounterRef)
+		}
+	}
+	if req.NarrativeSections != nil {
+		for i, nb := range *req.NarrativeSections {
+			check(fmt.Sprintf("narrativeSections[%d]", i), nb.ContextEncounterRef)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func validateEncounterTiming(field string, e http.Encounter) error {
+	if e.DurationMinutes != nil && *e.DurationMinutes < 0 {
+		return fmt.Errorf("%s.durationMinutes must not be negative", field)
+	}
+	if e.EndedAt == nil {
+		return nil
+	}
+	if e.OccurredAt == nil {
+		return fmt.Errorf("%s.endedAt requires occurredAt", field)
+	}
+	if e.EndedAt.Before(*e.OccurredAt) {
+		return fmt.Errorf("%s.endedAt is before occurredAt", field)
+	}
+	if e.DurationMinutes != nil && e.EndedAt.Sub(*e.OccurredAt).Round(time.Minute) != time.Duration(*e.DurationMinutes)*time.Minute {
+		return fmt.Errorf("%s.durationMinutes does not match occurredAt to endedAt", field)
+	}
 	return nil
 }
 
-func toEncounter(in http.EncounterWithRole) (http.Encounter, error) {
-	var out http.Encounter
+// validateObservations enforces a single value[x] per observation and that
+// UCUM quantities carry a valid unit code.
+func validateObservations(req http.UpdateRecordRequest) error {
+	if req.Observations == nil {
+		return nil
+	}
+	var problems []string
+	for i, ob := range *req.Observations {
+		set := 0
+		for _, present := range []bool{ob.ValueQuantity != nil, ob.ValueCodeableConcept != nil, ob.ValueString != nil, ob.ValueBoolean != nil, ob.ValuePeriod != nil} {
+			if present {
+				set++
+			}
+		}
+		if set > 1 {
+			problems = append(problems, fmt.Sprintf("observations[%d]: only one value[x] may be supplied", i))
+		}
+		if ob.ValuePeriod != nil && ob.ValuePeriod.Start == nil && ob.ValuePeriod.End == nil {
+			problems = append(problems, fmt.Sprintf("observations[%d].valuePeriod needs a start or an end", i))
+		}
+		if err := validateQuantity(ob.ValueQuantity); err != nil {
+			problems = append(problems, fmt.Sprintf("observations[%d].valueQuantity: %v", i, err))
+		}
+		if ob.Components != nil {
+			for j, c := range *ob.Components {
+				if err := validateQuantity(c.ValueQuantity); err != nil {
+					problems = append(problems, fmt.Sprintf("observations[%d].components[%d].valueQuantity: %v", i, j, err))
+				}
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func validateQuantity(q *http.Quantity) error {
+	if q == nil {
+		return nil
+	}
+	if q.Value == "" {
+		return errors.New("value is required")
+	}
+	if q.System == nil || *q.System != ucumSystem {
+		return nil
+	}
+	if q.Code == nil {
+		return errors.New("code is required for UCUM quantities")
+	}
+	return validateUCUM(*q.Code)
+}
+
+// encounterInput is an encounter together with the client ID that
+// observations and narrative use to attach to it.
+type encounterInput struct {
+	ID string
+	http.Encounter
+}
+
+func toEncounter(in http.EncounterWithRole) (encounterInput, error) {
+	out := encounterInput{}
+	if in.Id != nil {
+		out.ID = *in.Id
+	}
 	b, _ := json.Marshal(in)
-	return out, json.Unmarshal(b, &out)
+	return out, json.Unmarshal(b, &out.Encounter)
 }
 
-func resolveEncounters(req http.UpdateRecordRequest) (primary http.Encounter, related []http.Encounter) {
+func resolveEncounters(req http.UpdateRecordRequest) (primary encounterInput, related []encounterInput) {
 	if req.Encounters != nil && len(*req.Encounters) > 0 {
 		encounters := *req.Encounters
 
 		first := 0
 		for i, e := range encounters {
-			if *e.Role == "primary" {
+			if e.Role != nil && *e.Role == "primary" {
 				first = i
 				break
 			}
@@ -1177,7 +1631,7 @@ func resolveEncounters(req http.UpdateRecordRequest) (primary http.Encounter, re
 
 		p, _ := toEncounter(encounters[first])
 
-		var r []http.Encounter
+		var r []encounterInput
 		for i, e := range encounters {
 			if i != first {
 				ee, _ := toEncounter(e)
@@ -1188,12 +1642,14 @@ func resolveEncounters(req http.UpdateRecordRequest) (primary http.Encounter, re
 	}
 
 	if req.Encounter != nil {
-		return *req.Encounter, nil
+		return encounterInput{Encounter: *req.Encounter}, nil
 	}
 
-	return http.Encounter{}, nil
+	return encounterInput{}, nil
 }
 
+const bundleIdentifierSystem = "https://fhir.provider.example/identifier/bundle"
+
 func newURN() string          { return "urn:uuid:" + uuid.New().String() }
 func trimURN(u string) string { return strings.TrimPrefix(u, "urn:uuid:") }
 func idRef(u string) string   { return u } // keep urn as-is for reference
@@ -1205,11 +1661,18 @@ func optText(s string) *Text {
 	return &Text{Value: s}
 }
 
-func optDecimal(f *float32) *Text {
-	if f == nil {
+func optTextPtr(s *string) *Text {
+	if s == nil {
+		return nil
+	}
+	return optText(*s)
+}
+
+func optDecimal(n *json.Number) *Text {
+	if n == nil {
 		return nil
 	}
-	return &Text{Value: fmt.Sprintf("%.0f", *f)}
+	return &Text{Value: decimal(*n)}
 }
 
 func optAttr(s *string) *Attr {
@@ -1219,6 +1682,7 @@ func optAttr(s *string) *Attr {
 	return &Attr{Value: *s}
 }
 
+// splitName is the fallback for authors without a structuredName.
 func splitName(full string) (prefix, given, family string) {
 	parts := strings.Fields(full)
 	if len(parts) == 0 {
@@ -1249,11 +1713,42 @@ func codedOrDefault(cd *http.CompositionDetails) http.CodedItem {
 	}
 }
 
-func qToXML(q http.Quantity) *ValueQuantity {
-	out := &ValueQuantity{}
-	if q.Value != 0 {
-		out.Value = &Text{Value: fmt.Sprintf("%g", q.Value)}
+func rangesToXML(in *[]http.ReferenceRange) []ReferenceRange {
+	if in == nil {
+		return nil
+	}
+	var out []ReferenceRange
+	for _, r := range *in {
+		out = append(out, ReferenceRange{Low: quantity(r.Low), High: quantity(r.High), Text: optTextPtr(r.Text)})
+	}
+	return out
+}
+
+func quantity(q *http.Quantity) *Quantity {
+	if q == nil {
+		return nil
 	}
+	return &Quantity{
+		Value:  &Text{Value: decimal(q.Value)},
+		Unit:   optTextPtr(q.Unit),
+		System: optAttr(q.System),
+		Code:   optAttr(q.Code),
+	}
+}
+
+func codedToCC(c http.CodedItem) CodeableConcept {
+	text := c.Text
+	if text == nil {
+		text = c.Display
+	}
+	return CodeableConcept{
+		Coding: []Coding{{System: Attr{Value: c.System}, Code: Attr{Value: c.Code}, Display: optAttr(c.Display)}},
+		Text:   optTextPtr(text),
+	}
+}
+
+func qToXML(q http.Quantity) *ValueQuantity {
+	out := &ValueQuantity{Value: &Text{Value: decimal(q.Value)}}
 	if q.Unit != nil {
 		out.Unit = &Text{Value: *q.Unit}
 	}
@@ -0,0 +1,123 @@
+package common
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+// testConfig is a single sender with no reference data.
+var testConfig = Config{SenderMeshMailbox: "MBX", DefaultSenderODS: "FA123", DefaultRecipientType: "FI"}
+
+// testRequest is correctionRequest with change applied.
+func testRequest(t *testing.T, change func(req *http.UpdateRecordRequest)) http.UpdateRecordRequest {
+	t.Helper()
+	var req http.UpdateRecordRequest
+	if err := json.Unmarshal([]byte(correctionRequest), &req); err != nil {
+		t.Fatal(err)
+	}
+	if change != nil {
+		change(&req)
+	}
+	return req
+}
+
+func TestAttachmentsRefused(t *testing.T) {
+	req := testRequest(t, func(req *http.UpdateRecordRequest) {
+		req.Attachments = &[]http.Attachment{{ContentType: "application/pdf", Base64: "JVBERi0="}}
+	})
+	if _, err := BuildUpdateRecord(req, testConfig); err == nil || !strings.Contains(err.Error(), "attachments") {
+		t.Errorf("got %v, want attachments refused", err)
+	}
+}
+
+func TestMessageHeaderSource(t *testing.T) {
+	software := "PharmOutcomes"
+	req := testRequest(t, func(req *http.UpdateRecordRequest) {
+		req.Provenance.System.Software = &software
+	})
+	res, err := BuildUpdateRecord(req, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type value struct {
+		Value string `xml:"value,attr"`
+	}
+	var msg struct {
+		Entry []struct {
+			Resource struct {
+				MessageHeader *struct {
+					Source struct {
+						Extension []struct {
+							URL             string `xml:"url,attr"`
+							ValueIdentifier struct {
+								System value `xml:"system"`
+								Value  value `xml:"value"`
+							} `xml:"valueIdentifier"`
+						} `xml:"extension"`
+						Name     value `xml:"name"`
+						Software value `xml:"software"`
+						Endpoint value `xml:"endpoint"`
+					} `xml:"source"`
+				} `xml:"MessageHeader"`
+			} `xml:"resource"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(res.XML, &msg); err != nil {
+		t.Fatal(err)
+	}
+	mh := msg.Entry[0].Resource.MessageHeader
+	if mh == nil {
+		t.Fatal("first entry is not the MessageHeader")
+	}
+	src := mh.Source
+	if len(src.Extension) != 1 || src.Extension[0].URL != sourceASIDExtension ||
+		src.Extension[0].ValueIdentifier.System.Value != asidSystem || src.Extension[0].ValueIdentifier.Value.Value != "200000000115" {
+		t.Errorf("source extensions %+v, want the ASID 200000000115", src.Extension)
+	}
+	if src.Name.Value != "PMR" || src.Software.Value != software || src.Endpoint.Value != "MBX" {
+		t.Errorf("source name %q, software %q, endpoint %q; want PMR, %s, MBX", src.Name.Value, src.Software.Value, src.Endpoint.Value, software)
+	}
+}
+
+func TestRolesWithoutDisplay(t *testing.T) {
+	role := &http.CodeableConcept{System: "https://fhir.nhs.uk/STU3/CodeSystem/CareConnect-SDSJobRoleName-1", Code: "R8003"}
+	req := testRequest(t, func(req *http.UpdateRecordRequest) {
+		req.Provenance.Author.Role = role
+		req.Provenance.Participants = &[]http.Participant{{
+			Id:           "p1",
+			Practitioner: http.Author{Name: "Mr Ash Patel", Role: role},
+			Roles:        []http.ParticipantRoles{"performer"},
+		}}
+		req.Encounter.ReasonCode = &http.CodedItem{System: "http://snomed.info/sct", Code: "1659111000000107"}
+	})
+	if _, err := BuildUpdateRecord(req, testConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompositionOptional(t *testing.T) {
+	tests := []struct {
+		name        string
+		composition *http.CompositionDetails
+	}{
+		{"omitted", nil},
+		{"no title or type", &http.CompositionDetails{}},
+		{"type without display", &http.CompositionDetails{Type: &http.CodedItem{System: "http://snomed.info/sct", Code: "1659121000000101"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testRequest(t, func(req *http.UpdateRecordRequest) { req.Composition = tt.composition })
+			res, err := BuildUpdateRecord(req, testConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(res.XML), `<title value="Community service update">`) {
+				t.Error("composition has no default title")
+			}
+		})
+	}
+}
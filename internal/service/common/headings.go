@@ -0,0 +1,214 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ------------ Record Standard Headings ------------- */
+
+const headingSystem = "https://fhir.nhs.uk/CodeSystem/RecordStandardHeadings"
+
+const (
+	headingClinicalSummary     = "clinical-summary"
+	headingDiagnoses           = "diagnoses"
+	headingExaminationFindings = "examination-findings"
+	headingImmunisations       = "immunisations"
+	headingInvestigations      = "investigation-results"
+	headingMedications         = "medications-and-medical-devices"
+	headingPregnancyStatus     = "pregnancy-status"
+	headingProcedures          = "procedures"
+	headingReferrals           = "referrals"
+)
+
+// recordHeadings is the PRSB Record Standard Headings code system in the
+// order sections appear in the Composition.
+var recordHeadings = []struct{ Code, Display string }{
+	{"administrative-details", "Administrative details"},
+	{"gp-practice", "GP practice"},
+	{"referral-details", "Referral details"},
+	{"encounter-details", "Encounter details"},
+	{"reason-for-contact", "Reason for contact"},
+	{"presenting-complaints-or-issues", "Presenting complaints or issues"},
+	{"history", "History"},
+	{"past-medical-history", "Past medical history"},
+	{"family-history", "Family history"},
+	{"social-context", "Social context"},
+	{"lifestyle", "Lifestyle"},
+	{"individual-requirements", "Individual requirements"},
+	{"safety-alerts", "Safety alerts"},
+	{"allergies-and-adverse-reactions", "Allergies and adverse reactions"},
+	{headingMedications, "Medications and medical devices"},
+	{"medication-supplied", "Medication supplied"},
+	{headingImmunisations, "Immunisations"},
+	{"clinical-risk-factors", "Clinical risk factors"},
+	{headingPregnancyStatus, "Pregnancy status"},
+	{headingExaminationFindings, "Examination findings"},
+	{"vital-signs", "Vital signs"},
+	{"assessment-scales", "Assessment scales"},
+	{headingInvestigations, "Investigation results"},
+	{headingProcedures, "Procedures"},
+	{headingDiagnoses, "Diagnoses"},
+	{"problem-list", "Problem list"},
+	{headingClinicalSummary, "Clinical summary"},
+	{"information-and-advice-given", "Information and advice given"},
+	{"plan-and-requested-actions", "Plan and requested actions"},
+	{"outcome-of-consultation", "Outcome of consultation"},
+	{headingReferrals, "Referrals"},
+	{"legal-information", "Legal information"},
+	{"person-completing-record", "Person completing record"},
+	{"distribution-list", "Distribution list"},
+}
+
+// headingIndex maps a heading code to its position in recordHeadings.
+var headingIndex = func() map[string]int {
+	m := make(map[string]int, len(recordHeadings))
+	for i, h := range recordHeadings {
+		m[h.Code] = i
+	}
+	return m
+}()
+
+// heading returns the Record Standard Heading as a coded item.
+func heading(code string) *http.CodedItem {
+	display := recordHeadings[headingIndex[code]].Display
+	return &http.CodedItem{System: headingSystem, Code: code, Display: &display, Text: &display}
+}
+
+// headingCC is the heading as a CodeableConcept, or nil for unknown codes.
+func headingCC(code string) *CodeableConcept {
+	if _, ok := headingIndex[code]; !ok {
+		return nil
+	}
+	cc := codedToCC(*heading(code))
+	return &cc
+}
+
+// validateHeadings checks narrative heading codes and the heading tags on
+// observations, procedures, immunizations and referrals against the Record Standard Headings code system.
+func validateHeadings(req http.UpdateRecordRequest) error {
+	var problems []string
+	if req.NarrativeSections != nil {
+		for i, nb := range *req.NarrativeSections {
+			if _, ok := headingIndex[nb.HeadingCode]; !ok {
+				problems = append(problems, fmt.Sprintf("narrativeSections[%d].headingCode %q is not a Record Standard Heading", i, nb.HeadingCode))
+			}
+		}
+	}
+	if req.Observations != nil {
+		for i, ob := range *req.Observations {
+			problems = append(problems, checkHeadingTag(fmt.Sprintf("observations[%d]", i), ob.HeadingTag)...)
+		}
+	}
+	if req.Procedures != nil {
+		for i, p := range *req.Procedures {
+			problems = append(problems, checkHeadingTag(fmt.Sprintf("procedures[%d]", i), p.HeadingTag)...)
+		}
+	}
+	if req.Immunizations != nil {
+		for i, im := range *req.Immunizations {
+			problems = append(problems, checkHeadingTag(fmt.Sprintf("immunizations[%d]", i), im.HeadingTag)...)
+		}
+	}
+	if req.Referrals != nil {
+		for i, r := range *req.Referrals {
+			problems = append(problems, checkHeadingTag(fmt.Sprintf("referrals[%d]", i), r.HeadingTag)...)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func checkHeadingTag(field string, tag *http.CodedItem) []string {
+	switch {
+	case tag == nil:
+		return nil
+	case tag.System != headingSystem:
+		return []string{fmt.Sprintf("%s.headingTag.system must be %s", field, headingSystem)}
+	}
+	if _, ok := headingIndex[tag.Code]; !ok {
+		return []string{fmt.Sprintf("%s.headingTag.code %q is not a Record Standard Heading", field, tag.Code)}
+	}
+	return nil
+}
+
+// observationHeading files an observation under its heading tag, falling
+// back to a heading chosen from its category.
+func observationHeading(ob http.ObservationInput) string {
+	if ob.HeadingTag != nil {
+		return ob.HeadingTag.Code
+	}
+	if ob.Category != nil && ob.Category.Code == "laboratory" {
+		return headingInvestigations
+	}
+	return headingExaminationFindings
+}
+
+/* ---- Composition.section model ---- */
+
+// sectionModel groups document entries by heading and renders one
+// Composition.section per heading used, in Record Standard order.
+type sectionModel struct {
+	sections map[string]*CompositionSection
+	html     map[string]*xhtml
+	filed    map[string]string // heading code by entry fullUrl
+}
+
+func newSectionModel() *sectionModel {
+	return &sectionModel{sections: map[string]*CompositionSection{}, html: map[string]*xhtml{}, filed: map[string]string{}}
+}
+
+func (m *sectionModel) section(code string) (*CompositionSection, *xhtml) {
+	if s, ok := m.sections[code]; ok {
+		return s, m.html[code]
+	}
+	h := heading(code)
+	s := &CompositionSection{
+		Title: &Text{Value: *h.Display},
+		Code:  headingCC(code),
+	}
+	m.sections[code] = s
+	m.html[code] = &xhtml{}
+	return s, m.html[code]
+}
+
+// add files fullURL under the heading; the entry's own narrative is
+// reused as its part of the section text.
+func (m *sectionModel) add(code, fullURL string, text *Narrative) {
+	s, x := m.section(code)
+	s.Entry = append(s.Entry, struct {
+		Reference Reference `xml:"reference"`
+	}{Reference: Reference{RefValue: idRef(fullURL)}})
+	m.filed[fullURL] = code
+	if text != nil {
+		x.b.WriteString(text.Div.Inner)
+	}
+}
+
+// note adds free text to the heading's section narrative without an entry.
+// Blank text adds nothing, so a section never has neither text nor entries.
+func (m *sectionModel) note(code, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	_, x := m.section(code)
+	x.para(text)
+}
+
+func (m *sectionModel) build() []CompositionSection {
+	var out []CompositionSection
+	for _, h := range recordHeadings {
+		s, ok := m.sections[h.Code]
+		if !ok {
+			continue
+		}
+		s.Text = m.html[h.Code].narrative()
+		out = append(out, *s)
+	}
+	return out
+}
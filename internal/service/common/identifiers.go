@@ -0,0 +1,162 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ---- Business identifiers ---- */
+
+// DefaultIdentifierSystem is the base of the provider identifier systems
+// when none is configured. Each resource kind gets its own system under it,
+// e.g. <base>/observation.
+const DefaultIdentifierSystem = "https://fhir.provider.example/identifier"
+
+const nhsNumberSystem = "https://fhir.nhs.uk/Id/nhs-number"
+
+// identifiers issues business identifiers under one provider system, for
+// one sending organisation.
+type identifiers struct {
+	base   string
+	sender string // ODS code; scopes the resource ids derived from source IDs
+}
+
+func newIdentifiers(base, sender string) identifiers {
+	base = strings.TrimRight(strings.TrimSpace(base), "/")
+	if base == "" {
+		base = DefaultIdentifierSystem
+	}
+	return identifiers{base: base, sender: sender}
+}
+
+func (i identifiers) system(kind string) string {
+	return i.base + "/" + kind
+}
+
+// forResource is a resource's identifier: the sending system's source ID
+// when given, else the resource's own UUID.
+func (i identifiers) forResource(kind string, sourceID *string, fullURL string) Identifier {
+	value := trimURN(fullURL)
+	if s := sourceIDOf(sourceID); s != "" {
+		value = s
+	}
+	return Identifier{System: Attr{Value: i.system(kind)}, Value: Attr{Value: value}}
+}
+
+// stableID allocates the fullUrl for a resource that may carry a source ID.
+// With one the ID is a UUIDv5 of the identifier and the sender, so every
+// resend of the same source record gets the same resource id; without, key
+// names the resource.
+func (i identifiers) stableID(ids *resourceIDs, key, kind string, sourceID *string) string {
+	s := sourceIDOf(sourceID)
+	if s == "" {
+		return ids.id(key)
+	}
+	return ids.derived(kind+"|"+s, i.uuidName(kind, s))
+}
+
+// itemID allocates the fullUrl for the pos'th resource of a kind in the
+// request. A correction matches it to the original by source ID, else by
+// the client's id. With neither it can't be told from its neighbours, so
+// its ID is only reused when the same request is rebuilt to retract it.
+func (i identifiers) itemID(ids *resourceIDs, kind string, sourceID, clientID *string, pos int) string {
+	if s := sourceIDOf(sourceID); s != "" {
+		return ids.derived(kind+"|"+s, i.uuidName(kind, s))
+	}
+	if c := sourceIDOf(clientID); c != "" {
+		return ids.id(kind + "/" + c)
+	}
+	return ids.byPosition(fmt.Sprintf("%s#%d", kind, pos))
+}
+
+func sourceIDOf(sourceID *string) string {
+	if sourceID == nil {
+		return ""
+	}
+	return strings.TrimSpace(*sourceID)
+}
+
+// uuidName names a source ID for its UUIDv5: the identifier in FHIR token
+// form system|value, after the sender's ODS code. Tenants left on the
+// default identifier system share it, so without the sender the same
+// sourceId from two organisations would give the same resource id.
+func (i identifiers) uuidName(kind, sourceID string) string {
+	return i.sender + "|" + i.system(kind) + "|" + sourceID
+}
+
+// nameBasedURN is the UUIDv5 fullUrl for name under the URL namespace.
+func nameBasedURN(name string) string {
+	return "urn:uuid:" + uuid.NewSHA1(uuid.NameSpaceURL, []byte(name)).String()
+}
+
+// validateSourceIDs checks source IDs, and the client's own ids, are unique
+// within each kind of resource, since each one fixes a resource id in the
+// bundle and matches it up when the message is amended.
+func validateSourceIDs(req http.UpdateRecordRequest) error {
+	var problems []string
+	seen := map[string]string{} // kind|sourceId or kind/id -> first field
+	unique := func(key, field, name, value string) {
+		if first, dup := seen[key]; dup {
+			problems = append(problems, fmt.Sprintf("%s.%s %q is also used by %s", field, name, value, first))
+			return
+		}
+		seen[key] = field
+	}
+	check := func(kind, field string, sourceID *string, clientID ...*string) {
+		if s := sourceIDOf(sourceID); s != "" {
+			unique(kind+"|"+s, field, "sourceId", s)
+		}
+		for _, id := range clientID {
+			if c := sourceIDOf(id); c != "" {
+				unique(kind+"/"+c, field, "id", c)
+			}
+		}
+	}
+	if req.Encounter != nil {
+		check("encounter", "encounter", req.Encounter.SourceId)
+	}
+	if req.Encounters != nil {
+		for i, e := range *req.Encounters {
+			check("encounter", fmt.Sprintf("encounters[%d]", i), e.SourceId)
+		}
+	}
+	if req.Observations != nil {
+		for i, ob := range *req.Observations {
+			check("observation", fmt.Sprintf("observations[%d]", i), ob.SourceId, &ob.Id)
+		}
+	}
+	if req.Procedures != nil {
+		for i, p := range *req.Procedures {
+			check("procedure", fmt.Sprintf("procedures[%d]", i), p.SourceId, p.Id)
+		}
+	}
+	if req.Immunizations != nil {
+		for i, im := range *req.Immunizations {
+			check("immunization", fmt.Sprintf("immunizations[%d]", i), im.SourceId, im.Id)
+		}
+	}
+	if req.Referrals != nil {
+		for i, r := range *req.Referrals {
+			check("referral", fmt.Sprintf("referrals[%d]", i), r.SourceId, r.Id)
+		}
+	}
+	if req.NarrativeSections != nil {
+		for i, nb := range *req.NarrativeSections {
+			check("clinical-impression", fmt.Sprintf("narrativeSections[%d]", i), nb.SourceId)
+		}
+	}
+	if req.ClinicalSummary.MedicationsSupplied != nil {
+		for i, ms := range *req.ClinicalSummary.MedicationsSupplied {
+			check("medication-dispense", fmt.Sprintf("clinicalSummary.medicationsSupplied[%d]", i), ms.SourceId)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
@@ -0,0 +1,163 @@
+package common
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/dmd"
+)
+
+/* ---- Immunization ---- */
+
+type Immunization struct {
+	XMLName     xml.Name        `xml:"Immunization"`
+	ID          Attr            `xml:"id"`
+	Meta        Meta            `xml:"meta"`
+	Text        *Narrative      `xml:"text,omitempty"`
+	Identifier  []Identifier    `xml:"identifier"`
+	Status      Text            `xml:"status"`
+	NotGiven    Text            `xml:"notGiven"`
+	VaccineCode CodeableConcept `xml:"vaccineCode"`
+	Patient     struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"patient"`
+	Encounter struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"encounter"`
+	Date           Text                       `xml:"date"`
+	PrimarySource  Text                       `xml:"primarySource"`
+	LotNumber      *Text                      `xml:"lotNumber,omitempty"`
+	ExpirationDate *Text                      `xml:"expirationDate,omitempty"`
+	Site           *CodeableConcept           `xml:"site,omitempty"`
+	Route          *CodeableConcept           `xml:"route,omitempty"`
+	Practitioner   []ImmunizationPractitioner `xml:"practitioner"`
+	Note           []Annotation               `xml:"note,omitempty"`
+	Explanation    *ImmunizationExplanation   `xml:"explanation,omitempty"`
+	Protocol       []VaccinationProtocol      `xml:"vaccinationProtocol,omitempty"`
+}
+
+type ImmunizationPractitioner struct {
+	Role  CodeableConcept `xml:"role"`
+	Actor struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"actor"`
+}
+
+type ImmunizationExplanation struct {
+	ReasonNotGiven []CodeableConcept `xml:"reasonNotGiven,omitempty"`
+}
+
+type VaccinationProtocol struct {
+	DoseSequence  Text            `xml:"doseSequence"`
+	TargetDisease CodeableConcept `xml:"targetDisease"`
+	DoseStatus    CodeableConcept `xml:"doseStatus"`
+}
+
+// validateImmunizations checks each vaccination has a product and date, that
+// a vaccine not given says why, and that the batch had not expired. When a
+// dm+d extract is loaded the product is checked against it.
+func validateImmunizations(req http.UpdateRecordRequest, dict *dmd.Dictionary) ([]ValidationWarning, error) {
+	if req.Immunizations == nil {
+		return nil, nil
+	}
+	var problems []string
+	var warnings []ValidationWarning
+	for i, im := range *req.Immunizations {
+		field := fmt.Sprintf("immunizations[%d]", i)
+		if im.VaccineProduct.System == "" || im.VaccineProduct.Code == "" {
+			problems = append(problems, field+".vaccineProduct needs a system and code")
+		} else {
+			p, w := checkDmd(field+".vaccineProduct", im.VaccineProduct, dict)
+			problems = append(problems, p...)
+			warnings = append(warnings, w...)
+		}
+		if im.Date.IsZero() {
+			problems = append(problems, field+".date is required")
+		}
+		notGiven := im.NotGiven != nil && *im.NotGiven
+		switch {
+		case notGiven && im.ReasonNotGiven == nil:
+			problems = append(problems, field+".reasonNotGiven is required when notGiven is true")
+		case !notGiven && im.ReasonNotGiven != nil:
+			problems = append(problems, field+".reasonNotGiven is only allowed when notGiven is true")
+		}
+		if !notGiven && im.ExpiryDate != nil && !im.Date.IsZero() &&
+			im.ExpiryDate.String() < im.Date.In(ukZone).Format("2006-01-02") {
+			problems = append(problems, field+".expiryDate is before the vaccination date")
+		}
+		if im.DoseSequence != nil && im.TargetDisease == nil {
+			problems = append(problems, field+".targetDisease is required with doseSequence")
+		}
+		if im.Performer != nil && strings.TrimSpace(im.Performer.Name) == "" {
+			problems = append(problems, field+".performer.name is required")
+		}
+	}
+	if len(problems) > 0 {
+		return warnings, errors.New(strings.Join(problems, "; "))
+	}
+	return warnings, nil
+}
+
+func makeImmunization(id string, ident Identifier, im http.ImmunizationInput, patientID, encounterID, performerID, lastUpdated string) Immunization {
+	status := http.ImmunizationInputStatusCompleted
+	if im.Status != nil {
+		status = *im.Status
+	}
+	notGiven := im.NotGiven != nil && *im.NotGiven
+	out := Immunization{
+		ID:            Attr{Value: trimURN(id)},
+		Meta:          Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.hl7.org.uk/STU3/StructureDefinition/CareConnect-Immunization-1"}},
+		Identifier:    []Identifier{ident},
+		Status:        Text{Value: string(status)},
+		NotGiven:      Text{Value: fmt.Sprint(notGiven)},
+		VaccineCode:   codedToCC(im.VaccineProduct),
+		Date:          Text{Value: fhirDateTime(im.Date)},
+		PrimarySource: Text{Value: "true"}, // recorded by the pharmacy that gave it
+		LotNumber:     optTextPtr(im.BatchNumber),
+	}
+	out.Patient.Reference = Reference{RefValue: idRef(patientID)}
+	out.Encounter.Reference = Reference{RefValue: idRef(encounterID)}
+	if im.ExpiryDate != nil {
+		out.ExpirationDate = &Text{Value: im.ExpiryDate.String()}
+	}
+	if im.Site != nil {
+		cc := codedToCC(*im.Site)
+		out.Site = &cc
+	}
+	if im.Route != nil {
+		cc := codedToCC(*im.Route)
+		out.Route = &cc
+	}
+	role := "Administering Provider"
+	practitioner := ImmunizationPractitioner{
+		Role: codedToCC(http.CodedItem{System: "http://hl7.org/fhir/v2/0443", Code: "AP", Display: &role}),
+	}
+	practitioner.Actor.Reference = Reference{RefValue: idRef(performerID)}
+	out.Practitioner = []ImmunizationPractitioner{practitioner}
+	if im.Note != nil && strings.TrimSpace(*im.Note) != "" {
+		out.Note = []Annotation{{Text: Text{Value: *im.Note}}}
+	}
+	if notGiven && im.ReasonNotGiven != nil {
+		out.Explanation = &ImmunizationExplanation{ReasonNotGiven: []CodeableConcept{codedToCC(*im.ReasonNotGiven)}}
+	}
+	if im.DoseSequence != nil && im.TargetDisease != nil {
+		counts := "Counts"
+		out.Protocol = []VaccinationProtocol{{
+			DoseSequence:  Text{Value: fmt.Sprint(*im.DoseSequence)},
+			TargetDisease: codedToCC(*im.TargetDisease),
+			DoseStatus:    codedToCC(http.CodedItem{System: "http://hl7.org/fhir/vaccination-protocol-dose-status", Code: "count", Display: &counts}),
+		}}
+	}
+	return out
+}
+
+// immunizationHeading files an immunization under its heading tag, or immunisations.
+func immunizationHeading(im http.ImmunizationInput) string {
+	if im.HeadingTag != nil {
+		return im.HeadingTag.Code
+	}
+	return headingImmunisations
+}
@@ -0,0 +1,172 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ------------ Interpretation rules ------------- */
+
+const interpretationSystem = "http://hl7.org/fhir/v2/0078"
+
+// Blood pressure thresholds for the community pharmacy BP check (NICE NG136,
+// clinic readings): below 140/90 is normal, 180/120 and above is very high.
+const (
+	bpHighSystolic      = 140
+	bpHighDiastolic     = 90
+	bpVeryHighSystolic  = 180
+	bpVeryHighDiastolic = 120
+	heartRateLow        = 60
+	heartRateHigh       = 100
+)
+
+var (
+	bloodPressureCodes = map[string]bool{"163020007": true, "75367002": true, "163034007": true}
+	systolicCodes      = map[string]bool{"72313002": true, "271649006": true, "400974009": true}
+	diastolicCodes     = map[string]bool{"271650006": true, "1091811000000102": true, "400975005": true}
+	heartRateCodes     = map[string]bool{"364075005": true, "78564009": true}
+)
+
+// interpretationRule derives an interpretation for an observation in place.
+// It returns a sentence for the clinical summary when the reading is out of
+// range, or "" when there is nothing to report.
+type interpretationRule func(ob *http.ObservationInput) string
+
+// deriveInterpretations runs the rules over every SNOMED-coded observation
+// the client hasn't already interpreted, and adds a ClinicalImpression
+// (via a clinical-summary narrative) listing any out-of-range readings.
+func deriveInterpretations(req http.UpdateRecordRequest) http.UpdateRecordRequest {
+	if req.Observations == nil {
+		return req
+	}
+	obs := append([]http.ObservationInput(nil), *req.Observations...)
+	var findings []string
+	for i := range obs {
+		if obs[i].Code.System != "http://snomed.info/sct" || obs[i].Interpretation != nil {
+			continue
+		}
+		var rule interpretationRule
+		switch {
+		case bloodPressureCodes[obs[i].Code.Code]:
+			rule = interpretBloodPressure
+		case heartRateCodes[obs[i].Code.Code]:
+			rule = interpretHeartRate
+		default:
+			continue
+		}
+		if f := rule(&obs[i]); f != "" {
+			findings = append(findings, f)
+		}
+	}
+	req.Observations = &obs
+
+	if len(findings) > 0 {
+		req.NarrativeSections = appendTo(req.NarrativeSections, http.NarrativeBlock{
+			HeadingCode:    headingClinicalSummary,
+			HeadingDisplay: heading(headingClinicalSummary).Display,
+			Text:           strings.Join(findings, " "),
+		})
+	}
+	return req
+}
+
+func interpretBloodPressure(ob *http.ObservationInput) string {
+	if ob.Components == nil {
+		return ""
+	}
+	comps := append([]http.ObservationComponent(nil), *ob.Components...)
+	ob.Components = &comps
+
+	var sys, dia *http.ObservationComponent
+	for i := range comps {
+		switch code := comps[i].Code.Code; {
+		case systolicCodes[code]:
+			sys = &comps[i]
+		case diastolicCodes[code]:
+			dia = &comps[i]
+		}
+	}
+	if sys == nil || dia == nil || sys.ValueQuantity == nil || dia.ValueQuantity == nil {
+		return ""
+	}
+	s, d := floatOf(sys.ValueQuantity.Value), floatOf(dia.ValueQuantity.Value)
+
+	sys.Interpretation = interpretation(flag(s >= bpVeryHighSystolic, s >= bpHighSystolic))
+	dia.Interpretation = interpretation(flag(d >= bpVeryHighDiastolic, d >= bpHighDiastolic))
+	if sys.ReferenceRange == nil {
+		sys.ReferenceRange = &[]http.ReferenceRange{upperLimit(bpHighSystolic, "millimeter of mercury", "mm[Hg]")}
+	}
+	if dia.ReferenceRange == nil {
+		dia.ReferenceRange = &[]http.ReferenceRange{upperLimit(bpHighDiastolic, "millimeter of mercury", "mm[Hg]")}
+	}
+
+	veryHigh := s >= bpVeryHighSystolic || d >= bpVeryHighDiastolic
+	high := s >= bpHighSystolic || d >= bpHighDiastolic
+	ob.Interpretation = interpretation(flag(veryHigh, high))
+
+	switch {
+	case veryHigh:
+		return fmt.Sprintf("Blood pressure %g/%g mmHg is very high (180/120 mmHg or above): same-day GP assessment advised.", s, d)
+	case high:
+		return fmt.Sprintf("Blood pressure %g/%g mmHg is high (140/90 mmHg or above): ambulatory blood pressure monitoring advised.", s, d)
+	}
+	return ""
+}
+
+func interpretHeartRate(ob *http.ObservationInput) string {
+	if ob.ValueQuantity == nil {
+		return ""
+	}
+	hr := floatOf(ob.ValueQuantity.Value)
+	code := "N"
+	switch {
+	case hr < heartRateLow:
+		code = "L"
+	case hr > heartRateHigh:
+		code = "H"
+	}
+	ob.Interpretation = interpretation(code)
+	if ob.ReferenceRange == nil {
+		ob.ReferenceRange = &[]http.ReferenceRange{{
+			Low:  ucumQuantity(numberOf(heartRateLow), "per minute", "/min"),
+			High: ucumQuantity(numberOf(heartRateHigh), "per minute", "/min"),
+		}}
+	}
+	switch code {
+	case "L":
+		return fmt.Sprintf("Heart rate %g per minute is below %d.", hr, heartRateLow)
+	case "H":
+		return fmt.Sprintf("Heart rate %g per minute is above %d.", hr, heartRateHigh)
+	}
+	return ""
+}
+
+func flag(veryHigh, high bool) string {
+	switch {
+	case veryHigh:
+		return "HH"
+	case high:
+		return "H"
+	}
+	return "N"
+}
+
+var interpretationDisplay = map[string]string{
+	"N":  "Normal",
+	"H":  "High",
+	"HH": "Critically high",
+	"L":  "Low",
+	"LL": "Critically low",
+}
+
+func interpretation(code string) *http.CodedItem {
+	display := interpretationDisplay[code]
+	return &http.CodedItem{System: interpretationSystem, Code: code, Display: &display, Text: &display}
+}
+
+func upperLimit(v float64, unit, code string) http.ReferenceRange {
+	text := "NICE NG136 clinic threshold"
+	return http.ReferenceRange{High: ucumQuantity(numberOf(v), unit, code), Text: &text}
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/ods"
+)
+
+/* ---- Location ---- */
+
+type Location struct {
+	XMLName              xml.Name       `xml:"Location"`
+	ID                   Attr           `xml:"id"`
+	Meta                 Meta           `xml:"meta"`
+	Text                 *Narrative     `xml:"text,omitempty"`
+	Identifier           []Identifier   `xml:"identifier"`
+	Status               *Text          `xml:"status,omitempty"`
+	Name                 *Text          `xml:"name,omitempty"`
+	Telecom              []ContactPoint `xml:"telecom,omitempty"`
+	Address              *Address       `xml:"address,omitempty"`
+	ManagingOrganization *struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"managingOrganization,omitempty"`
+}
+
+type ContactPoint struct {
+	XMLName xml.Name `xml:"telecom"`
+	System  Text     `xml:"system"`
+	Value   Text     `xml:"value"`
+	Use     *Text    `xml:"use,omitempty"`
+}
+
+// EncounterLocation is Encounter.location (a backbone element wrapping the reference).
+type EncounterLocation struct {
+	XMLName  xml.Name `xml:"location"`
+	Location struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"location"`
+}
+
+// odsStatus maps ODS record status codes to Location.status.
+var odsStatus = map[string]string{
+	"A": "active",
+	"C": "inactive",
+	"D": "suspended",
+}
+
+// makeLocation builds a CareConnect-GPC Location for an ODS site code. When
+// the site is in the local ODS dataset its name, address and phone number are
+// included; otherwise only the site code is recorded.
+func makeLocation(id, siteODS, orgID string, sites *ods.Directory, lastUpdated string) Location {
+	loc := Location{
+		ID:   Attr{Value: trimURN(id)},
+		Meta: Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-GPC-Location-1"}},
+		Identifier: []Identifier{
+			{System: Attr{Value: "https://fhir.nhs.uk/Id/ods-site-code"}, Value: Attr{Value: strings.ToUpper(siteODS)}},
+		},
+		ManagingOrganization: &struct {
+			Reference Reference `xml:"reference"`
+		}{Reference: Reference{RefValue: idRef(orgID)}},
+	}
+
+	site, ok := sites.Lookup(siteODS)
+	if !ok {
+		return loc
+	}
+	if st, ok := odsStatus[site.Status]; ok {
+		loc.Status = &Text{Value: st}
+	}
+	if site.Name != "" {
+		loc.Name = &Text{Value: site.Name}
+	}
+	loc.Telecom = siteTelecom(site)
+	loc.Address = siteAddress(site)
+	return loc
+}
+
+// siteTelecom is the site's phone number, if ODS has one.
+func siteTelecom(site ods.Site) []ContactPoint {
+	if site.Phone == "" {
+		return nil
+	}
+	return []ContactPoint{{System: Text{Value: "phone"}, Value: Text{Value: site.Phone}, Use: &Text{Value: "work"}}}
+}
+
+// siteAddress is the site's postal address, or nil when ODS has none.
+func siteAddress(site ods.Site) *Address {
+	addr := Address{Use: &Text{Value: "work"}, Type: &Text{Value: "physical"}}
+	for _, l := range site.AddressLines {
+		addr.Line = append(addr.Line, Text{Value: l})
+	}
+	if site.Town != "" {
+		addr.City = &Text{Value: site.Town}
+	}
+	if site.County != "" {
+		addr.District = &Text{Value: site.County}
+	}
+	if site.Postcode != "" {
+		addr.PostalCode = &Text{Value: site.Postcode}
+	}
+	if addr.Line == nil && addr.City == nil && addr.PostalCode == nil {
+		return nil
+	}
+	return &addr
+}
+
+func encounterLocation(locationID string) []EncounterLocation {
+	el := EncounterLocation{}
+	el.Location.Reference = Reference{RefValue: idRef(locationID)}
+	return []EncounterLocation{el}
+}
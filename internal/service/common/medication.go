@@ -0,0 +1,119 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/dmd"
+)
+
+/* ------------ Medication supply ------------- */
+
+const dmdSystem = "https://dmd.nhs.uk"
+
+// dispenseStatus maps MedicationSupplied.status onto the STU3
+// MedicationDispense status. STU3 has no "declined", so a declined supply is
+// recorded as stopped with notDone set.
+func dispenseStatus(s http.MedicationSuppliedStatus) (status string, notDone bool, ok bool) {
+	switch s {
+	case http.MedicationSuppliedStatusPreparation,
+		http.MedicationSuppliedStatusInProgress,
+		http.MedicationSuppliedStatusOnHold,
+		http.MedicationSuppliedStatusCompleted,
+		http.MedicationSuppliedStatusEnteredInError,
+		http.MedicationSuppliedStatusStopped:
+		return string(s), false, true
+	case http.MedicationSuppliedStatusDeclined:
+		return "stopped", true, true
+	}
+	return "", false, false
+}
+
+// validateMedications checks every supply has a status we can record and,
+// when a dm+d extract is loaded, that dm+d coded medicines exist and are
+// still valid. A display that differs from the dm+d name is only a warning.
+func validateMedications(req http.UpdateRecordRequest, dict *dmd.Dictionary) ([]ValidationWarning, error) {
+	if req.ClinicalSummary.MedicationsSupplied == nil {
+		return nil, nil
+	}
+	var problems []string
+	var warnings []ValidationWarning
+	for i, ms := range *req.ClinicalSummary.MedicationsSupplied {
+		field := fmt.Sprintf("clinicalSummary.medicationsSupplied[%d]", i)
+		if _, _, ok := dispenseStatus(ms.Status); !ok {
+			problems = append(problems, fmt.Sprintf("%s.status %q cannot be recorded", field, ms.Status))
+		}
+		for name, q := range map[string]*http.Quantity{"quantity": ms.Quantity, "daysSupply": ms.DaysSupply} {
+			if err := validateQuantity(q); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.%s: %v", field, name, err))
+			}
+		}
+		p, w := checkDmd(field+".medication", ms.Medication, dict)
+		problems = append(problems, p...)
+		warnings = append(warnings, w...)
+	}
+	if len(problems) > 0 {
+		return warnings, errors.New(strings.Join(problems, "; "))
+	}
+	return warnings, nil
+}
+
+// checkDmd looks a dm+d or SNOMED coded medicine up in the dm+d extract.
+// Unknown and invalid codes are problems; a display that differs from the
+// dm+d name is a warning. Nothing is checked when no extract is loaded.
+func checkDmd(field string, code http.CodedItem, dict *dmd.Dictionary) ([]string, []ValidationWarning) {
+	if dict.Len() == 0 || (code.System != dmdSystem && code.System != "http://snomed.info/sct") {
+		return nil, nil
+	}
+	c, ok := dict.Lookup(code.Code)
+	switch {
+	case !ok:
+		return []string{fmt.Sprintf("%s.code %s is not in dm+d", field, code.Code)}, nil
+	case c.Invalid:
+		return []string{fmt.Sprintf("%s.code %s is flagged invalid in dm+d", field, code.Code)}, nil
+	case code.Display != nil && !strings.EqualFold(strings.TrimSpace(*code.Display), c.Name):
+		return nil, []ValidationWarning{{
+			Field:   field + ".display",
+			Message: fmt.Sprintf("%q does not match the dm+d %s name %q", *code.Display, c.Level, c.Name),
+		}}
+	}
+	return nil, nil
+}
+
+// decimal renders a FHIR decimal exactly as supplied (2.50 stays 2.50,
+// 0.1234567891 keeps every digit) and never in exponent form.
+func decimal(n json.Number) string {
+	s := strings.TrimSpace(string(n))
+	i := strings.IndexAny(s, "eE")
+	if i < 0 {
+		return s
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return s
+	}
+	// keep the mantissa's decimal places, shifted by the exponent
+	places := 0
+	if dot := strings.IndexByte(s[:i], '.'); dot >= 0 {
+		places = i - dot - 1
+	}
+	exp, _ := strconv.Atoi(s[i+1:])
+	return r.FloatString(max(places-exp, 0))
+}
+
+// floatOf is a quantity's value for arithmetic and threshold checks; 0 when
+// it isn't a number.
+func floatOf(n json.Number) float64 {
+	f, _ := n.Float64()
+	return f
+}
+
+// numberOf is a computed value as a decimal, in its shortest exact form.
+func numberOf(f float64) json.Number {
+	return json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+}
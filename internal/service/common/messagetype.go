@@ -0,0 +1,111 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ---- ITK3 message types ---- */
+
+// MessageEvent is an event from the ITK-MessageEvent-2 code system; it goes
+// on MessageHeader.event and tells the receiver how to handle the message.
+type MessageEvent struct {
+	Code    string
+	Display string
+}
+
+// MessageProfiles are the StructureDefinitions a message type's resources
+// claim in meta.profile.
+type MessageProfiles struct {
+	MessageBundle      string
+	MessageHeader      string
+	HeaderOrganization string
+	DocumentBundle     string
+	Composition        string
+}
+
+// MessageType is one kind of ITK3 message the gateway can send. Decode
+// parses a JSON request body into the type's own request schema; SenderODS,
+// NHSNumber, Build and Correct take what Decode returned. Correct is nil for types
+// that can't be amended or retracted.
+type MessageType struct {
+	Name      string // URL path segment, e.g. "update-record"
+	Event     MessageEvent
+	Profiles  MessageProfiles
+	Decode    func(body []byte) (any, error)
+	SenderODS func(req any) string // performer ODS named in the request; "" when none
+	NHSNumber func(req any) string // the patient's, for the audit log
+	Build     func(req any, cfg Config) (*BuildResult, error)
+	Correct   func(req any, cfg Config, c Correction) (*BuildResult, error)
+}
+
+var messageTypes = map[string]MessageType{}
+
+// RegisterMessageType makes a message type available by name. It panics on
+// a duplicate name or event code, as that is a programming error.
+func RegisterMessageType(t MessageType) {
+	if t.Name == "" || t.Event.Code == "" || t.Decode == nil || t.SenderODS == nil || t.NHSNumber == nil || t.Build == nil {
+		panic(fmt.Sprintf("common: message type %q is incomplete", t.Name))
+	}
+	for _, other := range messageTypes {
+		if other.Name == t.Name || other.Event.Code == t.Event.Code {
+			panic(fmt.Sprintf("common: message type %q (%s) registered twice", t.Name, t.Event.Code))
+		}
+	}
+	messageTypes[t.Name] = t
+}
+
+// LookupMessageType finds a registered message type by name.
+func LookupMessageType(name string) (MessageType, bool) {
+	t, ok := messageTypes[name]
+	return t, ok
+}
+
+// MessageTypeNames lists the registered message types, sorted.
+func MessageTypeNames() []string {
+	names := make([]string, 0, len(messageTypes))
+	for n := range messageTypes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/* ---- ITK014M Update Record ---- */
+
+// updateRecord is the Update Record message type. The builder reads its
+// event and profiles from here, like any other type's would.
+var updateRecord = MessageType{
+	Name:  string(http.UpdateRecord),
+	Event: MessageEvent{Code: "ITK014M", Display: "ITK Update Record"},
+	Profiles: MessageProfiles{
+		MessageBundle:      "https://fhir.nhs.uk/STU3/StructureDefinition/ITK-Message-Bundle-1",
+		MessageHeader:      "https://fhir.nhs.uk/STU3/StructureDefinition/ITK-MessageHeader-2",
+		HeaderOrganization: "https://fhir.nhs.uk/STU3/StructureDefinition/CareConnect-ITK-Header-Organization-1",
+		DocumentBundle:     "https://fhir.nhs.uk/STU3/StructureDefinition/ITK-Document-Bundle-1",
+		Composition:        "https://fhir.hl7.org.uk/STU3/StructureDefinition/CareConnect-Composition-1",
+	},
+	Decode: func(body []byte) (any, error) {
+		var req http.UpdateRecordRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	},
+	SenderODS: func(req any) string { return SenderODS(req.(http.UpdateRecordRequest)) },
+	NHSNumber: func(req any) string { return req.(http.UpdateRecordRequest).Patient.NhsNumber },
+}
+
+func init() {
+	// set here as they refer back to updateRecord
+	updateRecord.Build = func(req any, cfg Config) (*BuildResult, error) {
+		return BuildUpdateRecord(req.(http.UpdateRecordRequest), cfg)
+	}
+	updateRecord.Correct = func(req any, cfg Config, c Correction) (*BuildResult, error) {
+		return CorrectUpdateRecord(req.(http.UpdateRecordRequest), cfg, c)
+	}
+	RegisterMessageType(updateRecord)
+}
@@ -0,0 +1,500 @@
+package common
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+/* ------------ Narrative (text.div) ------------- */
+
+// Narrative is a resource's human-readable XHTML, which GP systems show
+// when they can't file the coded content. Every value is escaped on the
+// way in; the div only ever contains markup written by xhtml below.
+type Narrative struct {
+	XMLName xml.Name `xml:"text"`
+	Status  Text     `xml:"status"`
+	Div     struct {
+		XMLName xml.Name `xml:"http://www.w3.org/1999/xhtml div"`
+		Inner   string   `xml:",innerxml"`
+	}
+}
+
+// xhtml accumulates narrative markup.
+type xhtml struct{ b strings.Builder }
+
+func (x *xhtml) esc(s string) { _ = xml.EscapeText(&x.b, []byte(s)) }
+
+func (x *xhtml) heading(s string) {
+	x.b.WriteString("<h2>")
+	x.esc(s)
+	x.b.WriteString("</h2>")
+}
+
+// para writes free text as paragraphs: blank lines start a new paragraph
+// and single line breaks are kept.
+func (x *xhtml) para(s string) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "\r\n", "\n")
+	if s == "" {
+		return
+	}
+	for _, p := range strings.Split(s, "\n\n") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		x.b.WriteString("<p>")
+		for i, line := range strings.Split(p, "\n") {
+			if i > 0 {
+				x.b.WriteString("<br/>")
+			}
+			x.esc(line)
+		}
+		x.b.WriteString("</p>")
+	}
+}
+
+// fields writes label/value rows, skipping empty values, and nothing at
+// all when every value is empty.
+func (x *xhtml) fields(rows ...[2]string) {
+	var filled [][2]string
+	for _, r := range rows {
+		if strings.TrimSpace(r[1]) != "" {
+			filled = append(filled, r)
+		}
+	}
+	if len(filled) == 0 {
+		return
+	}
+	x.b.WriteString("<table><tbody>")
+	for _, r := range filled {
+		x.b.WriteString("<tr><th>")
+		x.esc(r[0])
+		x.b.WriteString("</th><td>")
+		x.esc(r[1])
+		x.b.WriteString("</td></tr>")
+	}
+	x.b.WriteString("</tbody></table>")
+}
+
+// table writes a grid with a header row; nothing when there are no rows.
+func (x *xhtml) table(head []string, rows [][]string) {
+	if len(rows) == 0 {
+		return
+	}
+	x.b.WriteString("<table><thead><tr>")
+	for _, h := range head {
+		x.b.WriteString("<th>")
+		x.esc(h)
+		x.b.WriteString("</th>")
+	}
+	x.b.WriteString("</tr></thead><tbody>")
+	for _, r := range rows {
+		x.b.WriteString("<tr>")
+		for _, c := range r {
+			x.b.WriteString("<td>")
+			x.esc(c)
+			x.b.WriteString("</td>")
+		}
+		x.b.WriteString("</tr>")
+	}
+	x.b.WriteString("</tbody></table>")
+}
+
+// narrative wraps the markup written so far, or is nil when there is none:
+// an empty div isn't valid FHIR, and the resource is better without text.
+func (x *xhtml) narrative() *Narrative {
+	if x.b.Len() == 0 {
+		return nil
+	}
+	n := &Narrative{Status: Text{Value: "generated"}}
+	n.Div.Inner = x.b.String()
+	return n
+}
+
+/* ---- per-resource narrative ---- */
+
+func patientNarrative(p PatientXML) *Narrative {
+	var x xhtml
+	name := ""
+	if len(p.Name) > 0 {
+		name = humanName(p.Name[0])
+	}
+	nhs := ""
+	for _, id := range p.Identifier {
+		if id.System.Value == "https://fhir.nhs.uk/Id/nhs-number" {
+			nhs = id.Value.Value
+		}
+	}
+	postcode := ""
+	if len(p.Address) > 0 {
+		postcode = textValue(p.Address[0].PostalCode)
+	}
+	x.fields(
+		[2]string{"Name", name},
+		[2]string{"NHS number", nhs},
+		[2]string{"Date of birth", displayDate(p.BirthDate.Value)},
+		[2]string{"Gender", textValue(p.Gender)},
+		[2]string{"Postcode", postcode},
+	)
+	return x.narrative()
+}
+
+func practitionerNarrative(p Practitioner) *Narrative {
+	var x xhtml
+	rows := [][2]string{}
+	if len(p.Name) > 0 {
+		rows = append(rows, [2]string{"Name", humanName(p.Name[0])})
+	}
+	for _, id := range p.Identifier {
+		label := id.System.Value
+		if t, ok := registrationBySystem(label); ok {
+			label = registrations[t].Label
+		}
+		rows = append(rows, [2]string{label, id.Value.Value})
+	}
+	x.fields(rows...)
+	return x.narrative()
+}
+
+func practitionerRoleNarrative(r PractitionerRole) *Narrative {
+	var x xhtml
+	x.fields([2]string{"Role", ccDisplay(&r.Code)})
+	return x.narrative()
+}
+
+func organizationNarrative(o Organization) *Narrative {
+	var x xhtml
+	rows := [][2]string{{"Name", textValue(o.Name)}}
+	for _, id := range o.Identifier {
+		rows = append(rows, [2]string{"ODS code", id.Value.Value})
+	}
+	for _, a := range o.Address {
+		rows = append(rows, [2]string{"Address", addressLine(a)})
+	}
+	for _, t := range o.Telecom {
+		rows = append(rows, [2]string{"Telephone", t.Value.Value})
+	}
+	x.fields(rows...)
+	return x.narrative()
+}
+
+func locationNarrative(l Location) *Narrative {
+	var x xhtml
+	rows := [][2]string{{"Name", textValue(l.Name)}}
+	for _, id := range l.Identifier {
+		rows = append(rows, [2]string{"ODS site code", id.Value.Value})
+	}
+	if l.Address != nil {
+		rows = append(rows, [2]string{"Address", addressLine(*l.Address)})
+	}
+	for _, t := range l.Telecom {
+		rows = append(rows, [2]string{"Telephone", t.Value.Value})
+	}
+	x.fields(rows...)
+	return x.narrative()
+}
+
+func encounterNarrative(e EncounterXML) *Narrative {
+	var x xhtml
+	rows := [][2]string{}
+	for _, t := range e.Type {
+		rows = append(rows, [2]string{"Type", ccDisplay(&t)})
+	}
+	if e.Period != nil {
+		rows = append(rows, [2]string{"Start", displayDateTime(e.Period.Start.Value)})
+		rows = append(rows, [2]string{"End", displayDateTime(textValue(e.Period.End))})
+	}
+	if e.Length != nil {
+		rows = append(rows, [2]string{"Duration", quantityDisplay(e.Length.Value, e.Length.Unit)})
+	}
+	for _, r := range e.Reason {
+		rows = append(rows, [2]string{"Reason", ccDisplay(&r)})
+	}
+	for _, ext := range e.Extension {
+		rows = append(rows, [2]string{"Outcome", ccDisplay(&ext.ValueCC)})
+	}
+	x.fields(rows...)
+	return x.narrative()
+}
+
+func observationNarrative(o Observation) *Narrative {
+	var x xhtml
+	value := ""
+	switch {
+	case o.ValueQuantity != nil:
+		value = quantityDisplay(o.ValueQuantity.Value, o.ValueQuantity.Unit)
+	case o.ValueCodeableConcept != nil:
+		value = ccDisplay(o.ValueCodeableConcept)
+	case o.ValueString != nil:
+		value = o.ValueString.Value
+	case o.ValueBoolean != nil:
+		value = map[string]string{"true": "Yes", "false": "No"}[o.ValueBoolean.Value]
+	case o.ValuePeriod != nil:
+		value = strings.Trim(displayDateTime(textValue(o.ValuePeriod.Start))+" - "+displayDateTime(textValue(o.ValuePeriod.End)), " -")
+	}
+	rows := [][2]string{
+		{"Observation", ccDisplay(&o.Code)},
+		{"Value", value},
+		{"Interpretation", ccDisplay(o.Interpretation)},
+		{"Reference range", rangeDisplay(o.ReferenceRange)},
+		{"Body site", ccDisplay(o.BodySite)},
+		{"Date", displayDateTime(textValue(o.EffectiveDateTime))},
+	}
+	x.fields(rows...)
+	if len(o.Component) > 0 {
+		var grid [][]string
+		for _, c := range o.Component {
+			v := ccDisplay(c.ValueCodeableConcept)
+			if c.ValueQuantity != nil {
+				v = quantityDisplay(c.ValueQuantity.Value, c.ValueQuantity.Unit)
+			}
+			grid = append(grid, []string{ccDisplay(&c.Code), v, ccDisplay(c.Interpretation), rangeDisplay(c.ReferenceRange)})
+		}
+		x.table([]string{"Component", "Value", "Interpretation", "Reference range"}, grid)
+	}
+	return x.narrative()
+}
+
+func procedureNarrative(p Procedure) *Narrative {
+	var x xhtml
+	rows := [][2]string{
+		{"Procedure", ccDisplay(&p.Code)},
+		{"Status", p.Status.Value},
+		{"Performed", displayDateTime(p.PerformedDateTime.Value)},
+		{"Outcome", ccDisplay(p.Outcome)},
+	}
+	for _, b := range p.BodySite {
+		rows = append(rows, [2]string{"Body site", ccDisplay(&b)})
+	}
+	x.fields(rows...)
+	for _, n := range p.Note {
+		x.para(n.Text.Value)
+	}
+	return x.narrative()
+}
+
+func immunizationNarrative(im Immunization) *Narrative {
+	var x xhtml
+	given := "Given"
+	if im.NotGiven.Value == "true" {
+		given = "Not given"
+	}
+	rows := [][2]string{
+		{"Vaccine", ccDisplay(&im.VaccineCode)},
+		{given, displayDateTime(im.Date.Value)},
+		{"Status", im.Status.Value},
+		{"Batch", textValue(im.LotNumber)},
+		{"Site", ccDisplay(im.Site)},
+		{"Route", ccDisplay(im.Route)},
+	}
+	if im.ExpirationDate != nil {
+		rows = append(rows, [2]string{"Expiry", displayDate(im.ExpirationDate.Value)})
+	}
+	for _, p := range im.Protocol {
+		rows = append(rows, [2]string{"Dose", p.DoseSequence.Value + " (" + ccDisplay(&p.TargetDisease) + ")"})
+	}
+	if im.Explanation != nil {
+		for _, r := range im.Explanation.ReasonNotGiven {
+			rows = append(rows, [2]string{"Reason not given", ccDisplay(&r)})
+		}
+	}
+	x.fields(rows...)
+	for _, n := range im.Note {
+		x.para(n.Text.Value)
+	}
+	return x.narrative()
+}
+
+func referralRequestNarrative(r ReferralRequest) *Narrative {
+	var x xhtml
+	rows := [][2]string{
+		{"Priority", r.Priority.Value},
+		{"Service", ccDisplay(r.ServiceRequested)},
+	}
+	for _, rc := range r.ReasonCode {
+		rows = append(rows, [2]string{"Reason", ccDisplay(&rc)})
+	}
+	rows = append(rows,
+		[2]string{"Referred", displayDateTime(r.AuthoredOn.Value)},
+		[2]string{"Due by", displayDateTime(textValue(r.OccurrencePeriod.End))},
+	)
+	x.fields(rows...)
+	x.para(textValue(r.Description))
+	return x.narrative()
+}
+
+func deviceNarrative(d Device) *Narrative {
+	var x xhtml
+	rows := [][2]string{
+		{"System", d.Model.Value},
+		{"Version", textValue(d.Version)},
+		{"Manufacturer", textValue(d.Manufacturer)},
+	}
+	for _, id := range d.Identifier {
+		rows = append(rows, [2]string{"ASID", id.Value.Value})
+	}
+	x.fields(rows...)
+	return x.narrative()
+}
+
+func provenanceNarrative(p ProvenanceXML, author, system string) *Narrative {
+	var x xhtml
+	rows := [][2]string{
+		{"Author", author},
+		{"System", system},
+	}
+	for _, s := range p.Signature {
+		rows = append(rows, [2]string{"Signed", displayDateTime(s.When.Value)})
+	}
+	x.fields(rows...)
+	return x.narrative()
+}
+
+func clinicalImpressionNarrative(heading string, c ClinicalImpression) *Narrative {
+	var x xhtml
+	if heading != "" {
+		x.heading(heading)
+	}
+	x.para(c.Summary.Value)
+	return x.narrative()
+}
+
+func medicationDispenseNarrative(m MedicationDispense) *Narrative {
+	var x xhtml
+	rows := [][2]string{
+		{"Medication", ccDisplay(m.MedicationCodeableConcept)},
+		{"Status", m.Status.Value},
+		{"Supply type", ccDisplay(m.Type)},
+	}
+	if m.Quantity != nil {
+		rows = append(rows, [2]string{"Quantity", quantityDisplay(m.Quantity.Value, m.Quantity.Unit)})
+	}
+	if m.DaysSupply != nil {
+		rows = append(rows, [2]string{"Days supply", quantityDisplay(m.DaysSupply.Value, m.DaysSupply.Unit)})
+	}
+	for _, d := range m.DosageInstruction {
+		rows = append(rows, [2]string{"Dosage", textValue(d.Text)}, [2]string{"Patient instructions", textValue(d.PatientInstruction)})
+	}
+	rows = append(rows, [2]string{"Handed over", displayDate(textValue(m.WhenHandedOver))})
+	x.fields(rows...)
+	return x.narrative()
+}
+
+// compositionNarrative is the document summary shown at the top of the
+// record: title, date and the clinician's free-text summary, and for a
+// correction its status and reason.
+func compositionNarrative(c Composition, freeText, reason string) *Narrative {
+	var x xhtml
+	x.heading(c.Title.Value)
+	rows := [][2]string{
+		{"Type", ccDisplay(&c.Type)},
+		{"Date", displayDateTime(c.Date.Value)},
+	}
+	if c.Status.Value != "final" {
+		rows = append(rows, [2]string{"Status", c.Status.Value}, [2]string{"Reason", reason})
+	}
+	x.fields(rows...)
+	x.para(freeText)
+	return x.narrative()
+}
+
+/* ---- display helpers ---- */
+
+func textValue(t *Text) string {
+	if t == nil {
+		return ""
+	}
+	return t.Value
+}
+
+// ccDisplay prefers the concept text, then the first coding display, then the code.
+func ccDisplay(cc *CodeableConcept) string {
+	if cc == nil {
+		return ""
+	}
+	if cc.Text != nil && cc.Text.Value != "" {
+		return cc.Text.Value
+	}
+	for _, c := range cc.Coding {
+		if c.Display != nil && c.Display.Value != "" {
+			return c.Display.Value
+		}
+	}
+	if len(cc.Coding) > 0 {
+		return cc.Coding[0].Code.Value
+	}
+	return ""
+}
+
+func quantityDisplay(value, unit *Text) string {
+	return strings.TrimSpace(textValue(value) + " " + textValue(unit))
+}
+
+func rangeDisplay(rr []ReferenceRange) string {
+	var parts []string
+	for _, r := range rr {
+		var s string
+		switch {
+		case r.Low != nil && r.High != nil:
+			s = textValue(r.Low.Value) + "-" + quantityDisplay(r.High.Value, r.High.Unit)
+		case r.High != nil:
+			s = "below " + quantityDisplay(r.High.Value, r.High.Unit)
+		case r.Low != nil:
+			s = "above " + quantityDisplay(r.Low.Value, r.Low.Unit)
+		}
+		if r.Text != nil {
+			s = strings.TrimSpace(s + " (" + r.Text.Value + ")")
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func humanName(n HumanName) string {
+	var parts []string
+	for _, p := range n.Prefix {
+		parts = append(parts, p.Value)
+	}
+	for _, g := range n.Given {
+		parts = append(parts, g.Value)
+	}
+	parts = append(parts, strings.ToUpper(n.Family.Value))
+	for _, s := range n.Suffix {
+		parts = append(parts, s.Value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func addressLine(a Address) string {
+	var parts []string
+	for _, l := range a.Line {
+		parts = append(parts, l.Value)
+	}
+	for _, t := range []*Text{a.City, a.District, a.PostalCode} {
+		if t != nil {
+			parts = append(parts, t.Value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// displayDateTime renders a FHIR dateTime the way GP systems show it,
+// e.g. "01-Jul-2025 09:30", in UK time.
+func displayDateTime(v string) string {
+	if v == "" {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return displayDate(v)
+	}
+	return t.In(ukZone).Format("02-Jan-2006 15:04")
+}
+
+func displayDate(v string) string {
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return v
+	}
+	return t.Format("02-Jan-2006")
+}
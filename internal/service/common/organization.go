@@ -0,0 +1,86 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+	"github.com/Cleo-Systems/elevate-gpconnect/internal/service/ods"
+)
+
+/* ---- Organization ---- */
+
+// makeOrganization builds an Organization for an ODS code. When the code is
+// in the local ODS dataset its name, status, phone number and address are
+// included so the receiving system can show who the organisation is.
+func makeOrganization(id, profile, code string, sites *ods.Directory, lastUpdated string) Organization {
+	org := Organization{
+		ID:   Attr{Value: trimURN(id)},
+		Meta: Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: profile}},
+		Identifier: []Identifier{
+			{System: Attr{Value: "https://fhir.nhs.uk/Id/ods-organization-code"}, Value: Attr{Value: code}},
+		},
+	}
+	site, ok := sites.Lookup(code)
+	if !ok {
+		return org
+	}
+	if site.Status != "" {
+		org.Active = &Text{Value: fmt.Sprint(site.Status == "A")}
+	}
+	if site.Name != "" {
+		org.Name = &Text{Value: site.Name}
+	}
+	org.Telecom = siteTelecom(site)
+	if addr := siteAddress(site); addr != nil {
+		org.Address = []Address{*addr}
+	}
+	return org
+}
+
+// validateODSCodes checks every ODS code in the request, and the default
+// sender ODS when the request names no sender, is in the local ODS dataset
+// and open on the given day. Nothing is checked when no dataset is loaded.
+func validateODSCodes(req http.UpdateRecordRequest, defaultSender string, sites *ods.Directory, on time.Time) error {
+	if sites.Len() == 0 {
+		return nil
+	}
+	var problems []string
+	check := func(field string, code *string) {
+		if code == nil || strings.TrimSpace(*code) == "" {
+			return
+		}
+		site, ok := sites.Lookup(*code)
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s %q is not a known ODS code", field, *code))
+		case !site.Active(on):
+			problems = append(problems, fmt.Sprintf("%s %q is not active in ODS", field, *code))
+		}
+	}
+	if req.Encounter != nil {
+		check("encounter.performerODS", req.Encounter.PerformerODS)
+		check("encounter.locationODS", req.Encounter.LocationODS)
+	}
+	if req.Encounters != nil {
+		for i, e := range *req.Encounters {
+			check(fmt.Sprintf("encounters[%d].performerODS", i), e.PerformerODS)
+			check(fmt.Sprintf("encounters[%d].locationODS", i), e.LocationODS)
+		}
+	}
+	if req.Referrals != nil {
+		for i, r := range *req.Referrals {
+			check(fmt.Sprintf("referrals[%d].recipientODS", i), &r.RecipientODS)
+		}
+	}
+	check("routing.registeredPracticeODS", &req.Routing.RegisteredPracticeODS)
+	if SenderODS(req) == "" {
+		check("default sender ODS", &defaultSender)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
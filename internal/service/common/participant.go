@@ -0,0 +1,169 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ---- Consultation participants ---- */
+
+// participantTypes codes each participant role on Encounter.participant.
+var participantTypes = map[http.ParticipantRoles]struct{ System, Code, Display string }{
+	http.Recorder:   {"https://fhir.nhs.uk/STU3/CodeSystem/GPConnect-ParticipantType-1", "REC", "recorder"},
+	http.Performer:  {"https://fhir.nhs.uk/STU3/CodeSystem/GPConnect-ParticipantType-1", "PPRF", "primary performer"},
+	http.Authoriser: {"http://hl7.org/fhir/v3/ParticipationType", "AUTHEN", "authenticator"},
+}
+
+// validateParticipants checks participant IDs are unique, roles are known,
+// and that observations only point at participants that exist.
+func validateParticipants(req http.UpdateRecordRequest) error {
+	var participants []http.Participant
+	if req.Provenance.Participants != nil {
+		participants = *req.Provenance.Participants
+	}
+	var problems []string
+	ids := map[string]bool{}
+	for i, p := range participants {
+		field := fmt.Sprintf("provenance.participants[%d]", i)
+		id := strings.TrimSpace(p.Id)
+		switch {
+		case id == "":
+			problems = append(problems, field+".id is required")
+		case ids[id]:
+			problems = append(problems, fmt.Sprintf("%s.id %q is used more than once", field, p.Id))
+		}
+		ids[id] = true
+		if len(p.Roles) == 0 {
+			problems = append(problems, field+".roles needs at least one role")
+		}
+		for j, r := range p.Roles {
+			if _, ok := participantTypes[r]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.roles[%d] %q must be one of recorder, performer, authoriser", field, j, r))
+			}
+		}
+		if strings.TrimSpace(p.Practitioner.Name) == "" {
+			problems = append(problems, field+".practitioner.name is required")
+		}
+	}
+	if req.Observations != nil {
+		for i, ob := range *req.Observations {
+			if ob.PerformerRef != nil && !ids[strings.TrimSpace(*ob.PerformerRef)] {
+				problems = append(problems, fmt.Sprintf("observations[%d].performerRef %q is not a participant id", i, *ob.PerformerRef))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// careTeam maps participants onto their Practitioner fullUrls. Without
+// participants the author is the only member and fills every role.
+type careTeam struct {
+	authorID string
+	byID     map[string]string // participant id -> fullUrl
+	names    map[string]string // fullUrl -> display name
+	members  []string          // fullUrls in request order
+	roles    map[string][]http.ParticipantRoles
+}
+
+func newCareTeam(req http.UpdateRecordRequest, authorID string, practitionerFor func(*http.Author) string) *careTeam {
+	t := &careTeam{
+		authorID: authorID,
+		byID:     map[string]string{},
+		names:    map[string]string{authorID: req.Provenance.Author.Name},
+		roles:    map[string][]http.ParticipantRoles{},
+	}
+	if req.Provenance.Participants == nil || len(*req.Provenance.Participants) == 0 {
+		t.members = []string{authorID}
+		t.roles[authorID] = []http.ParticipantRoles{http.Recorder}
+		return t
+	}
+	for _, p := range *req.Provenance.Participants {
+		a := p.Practitioner
+		id := practitionerFor(&a)
+		t.byID[strings.TrimSpace(p.Id)] = id
+		t.names[id] = a.Name
+		if _, ok := t.roles[id]; !ok {
+			t.members = append(t.members, id)
+		}
+		for _, r := range p.Roles {
+			if !hasRole(t.roles[id], r) {
+				t.roles[id] = append(t.roles[id], r)
+			}
+		}
+	}
+	return t
+}
+
+func hasRole(roles []http.ParticipantRoles, r http.ParticipantRoles) bool {
+	for _, x := range roles {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
+
+// withRole lists members holding the role, in request order.
+func (t *careTeam) withRole(r http.ParticipantRoles) []string {
+	var out []string
+	for _, id := range t.members {
+		if hasRole(t.roles[id], r) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// encounterParticipants lists every member with a type per role.
+func (t *careTeam) encounterParticipants() []EncounterParticipant {
+	var out []EncounterParticipant
+	for _, id := range t.members {
+		p := EncounterParticipant{}
+		for _, r := range t.roles[id] {
+			pt := participantTypes[r]
+			p.Type = append(p.Type, CodeableConcept{
+				Coding: []Coding{{System: Attr{Value: pt.System}, Code: Attr{Value: pt.Code}}},
+				Text:   optText(pt.Display),
+			})
+		}
+		p.Individual.Reference = Reference{RefValue: idRef(id)}
+		out = append(out, p)
+	}
+	return out
+}
+
+// observationPerformer resolves performerRef, falling back to the first
+// performer, then the first recorder, then the author.
+func (t *careTeam) observationPerformer(ref *string) string {
+	if ref != nil {
+		if id, ok := t.byID[strings.TrimSpace(*ref)]; ok {
+			return id
+		}
+	}
+	if ids := t.withRole(http.Performer); len(ids) > 0 {
+		return ids[0]
+	}
+	if ids := t.withRole(http.Recorder); len(ids) > 0 {
+		return ids[0]
+	}
+	return t.authorID
+}
+
+// authorisers are the Composition authors; the author when nobody is
+// named as authoriser.
+func (t *careTeam) authorisers() []string {
+	if ids := t.withRole(http.Authoriser); len(ids) > 0 {
+		return ids
+	}
+	return []string{t.authorID}
+}
+
+func (t *careTeam) name(id string) string {
+	return t.names[id]
+}
@@ -0,0 +1,225 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ------------ Pharmacy First clinical pathways ------------- */
+
+// pathwayRule describes what a Pharmacy First pathway needs before it can be
+// recorded: the condition it treats, the eligible patients and any
+// pathway-specific checks (FeverPAIN, symptom duration).
+type pathwayRule struct {
+	Condition http.CodedItem
+	MinAge    int // inclusive, in years
+	MaxAge    int // inclusive, 0 = no upper limit
+	Female    bool
+	Check     func(pf http.PharmacyFirstConsultation) []string
+}
+
+var pathwayRules = map[http.PharmacyFirstConsultationPathway]pathwayRule{
+	http.AcuteOtitisMedia: {
+		Condition: snomed("3110003", "Acute otitis media"),
+		MinAge:    1,
+		MaxAge:    17,
+	},
+	http.Impetigo: {
+		Condition: snomed("48277006", "Impetigo"),
+		MinAge:    1,
+	},
+	http.InfectedInsectBites: {
+		Condition: snomed("283353003", "Infected insect bite"),
+		MinAge:    1,
+	},
+	http.Shingles: {
+		Condition: snomed("4740000", "Herpes zoster"),
+		MinAge:    18,
+	},
+	http.Sinusitis: {
+		Condition: snomed("15805002", "Acute sinusitis"),
+		MinAge:    12,
+		Check: func(pf http.PharmacyFirstConsultation) []string {
+			switch {
+			case pf.SymptomDurationDays == nil:
+				return []string{"symptomDurationDays is required for sinusitis"}
+			case *pf.SymptomDurationDays < 10 && pf.Outcome == http.Supply:
+				return []string{"sinusitis supply requires symptoms for 10 days or more"}
+			}
+			return nil
+		},
+	},
+	http.SoreThroat: {
+		Condition: snomed("363746003", "Acute pharyngitis"),
+		MinAge:    5,
+		Check: func(pf http.PharmacyFirstConsultation) []string {
+			switch {
+			case pf.FeverPainScore == nil:
+				return []string{"feverPainScore is required for sore-throat"}
+			case *pf.FeverPainScore < 4 && pf.Outcome == http.Supply:
+				return []string{"sore-throat supply requires a FeverPAIN score of 4 or 5"}
+			}
+			return nil
+		},
+	},
+	http.UncomplicatedUti: {
+		Condition: snomed("68566005", "Urinary tract infectious disease"),
+		MinAge:    16,
+		MaxAge:    64,
+		Female:    true,
+	},
+}
+
+// validatePharmacyFirst checks the consultation against its pathway rules
+// and reports every problem at once so the PMR can fix them in one go.
+func validatePharmacyFirst(req http.UpdateRecordRequest) error {
+	pf := req.PharmacyFirst
+	if pf == nil {
+		return nil
+	}
+	rule, ok := pathwayRules[pf.Pathway]
+	if !ok {
+		return fmt.Errorf("pharmacyFirst.pathway %q is not supported", pf.Pathway)
+	}
+
+	var problems []string
+	primary, _ := resolveEncounters(req)
+	seenAt := time.Now()
+	if primary.OccurredAt != nil {
+		seenAt = *primary.OccurredAt
+	}
+	age := ageAt(req.Patient.DateOfBirth.Time, seenAt.In(ukZone))
+	switch {
+	case age < rule.MinAge:
+		problems = append(problems, fmt.Sprintf("patient aged %d is below the minimum age of %d for %s", age, rule.MinAge, pf.Pathway))
+	case rule.MaxAge > 0 && age > rule.MaxAge:
+		problems = append(problems, fmt.Sprintf("patient aged %d is above the maximum age of %d for %s", age, rule.MaxAge, pf.Pathway))
+	}
+	if rule.Female && (req.Patient.Gender == nil || *req.Patient.Gender != http.PatientGenderFemale) {
+		problems = append(problems, fmt.Sprintf("%s is only available to female patients", pf.Pathway))
+	}
+	if rule.Check != nil {
+		problems = append(problems, rule.Check(*pf)...)
+	}
+	if pf.Findings != nil {
+		for i, f := range *pf.Findings {
+			if f.Display == nil && f.Text == nil {
+				problems = append(problems, fmt.Sprintf("findings[%d] needs a display or text", i))
+			}
+		}
+	}
+
+	supplies := 0
+	if pf.Supply != nil {
+		supplies = len(*pf.Supply)
+	}
+	switch pf.Outcome {
+	case http.Supply:
+		if !pf.GatewayCriteriaMet {
+			problems = append(problems, "a supply cannot be made when the gateway criteria are not met")
+		}
+		if supplies == 0 {
+			problems = append(problems, "supply is required when outcome is supply")
+		}
+	case http.OnwardReferral:
+		if pf.ReferralReason == nil || strings.TrimSpace(*pf.ReferralReason) == "" {
+			problems = append(problems, "referralReason is required when outcome is onward-referral")
+		}
+		fallthrough
+	case http.AdviceOnly:
+		if supplies > 0 {
+			problems = append(problems, fmt.Sprintf("supply must be empty when outcome is %s", pf.Outcome))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("outcome %q is not supported", pf.Outcome))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("pharmacyFirst: " + strings.Join(problems, "; "))
+}
+
+// expandPharmacyFirstPathway records the pathway as coded observations, a
+// clinical-summary narrative and any medication supplied under the PGD.
+func expandPharmacyFirstPathway(req http.UpdateRecordRequest) http.UpdateRecordRequest {
+	pf := req.PharmacyFirst
+	if pf == nil {
+		return req
+	}
+	rule := pathwayRules[pf.Pathway]
+	primary, _ := resolveEncounters(req)
+	at := time.Now()
+	if primary.OccurredAt != nil {
+		at = *primary.OccurredAt
+	}
+
+	addObservation(&req, http.ObservationInput{
+		Status:            http.Final,
+		Category:          observationCategory("exam", "Exam"),
+		Code:              rule.Condition,
+		EffectiveDateTime: at,
+		HeadingTag:        heading(headingDiagnoses),
+	})
+	if pf.Findings != nil {
+		for _, f := range *pf.Findings {
+			if f.Display == nil {
+				f.Display = f.Text
+			}
+			if f.Text == nil {
+				f.Text = f.Display
+			}
+			addObservation(&req, http.ObservationInput{
+				Status:            http.Final,
+				Category:          observationCategory("exam", "Exam"),
+				Code:              f,
+				EffectiveDateTime: at,
+			})
+		}
+	}
+
+	summary := []string{fmt.Sprintf("Pharmacy First %s pathway (%s).", strings.ReplaceAll(string(pf.Pathway), "-", " "), *rule.Condition.Display)}
+	if pf.GatewayCriteriaMet {
+		summary = append(summary, "Gateway criteria met.")
+	} else {
+		summary = append(summary, "Gateway criteria not met.")
+	}
+	if pf.FeverPainScore != nil {
+		summary = append(summary, fmt.Sprintf("FeverPAIN score %d.", *pf.FeverPainScore))
+	}
+	if pf.SymptomDurationDays != nil {
+		summary = append(summary, fmt.Sprintf("Symptoms for %d days.", *pf.SymptomDurationDays))
+	}
+	switch pf.Outcome {
+	case http.Supply:
+		summary = append(summary, "Outcome: supply made.")
+	case http.AdviceOnly:
+		summary = append(summary, "Outcome: advice only.")
+	case http.OnwardReferral:
+		summary = append(summary, "Outcome: onward referral - "+*pf.ReferralReason)
+	}
+	nb := http.NarrativeBlock{
+		HeadingCode:    headingClinicalSummary,
+		HeadingDisplay: heading(headingClinicalSummary).Display,
+		Text:           strings.Join(summary, " "),
+	}
+	req.NarrativeSections = appendTo(req.NarrativeSections, nb)
+
+	if pf.Supply != nil && len(*pf.Supply) > 0 {
+		req.ClinicalSummary.MedicationsSupplied = appendTo(req.ClinicalSummary.MedicationsSupplied, *pf.Supply...)
+	}
+	return req
+}
+
+// ageAt returns the age in whole years on the given date.
+func ageAt(dob, on time.Time) int {
+	age := on.Year() - dob.Year()
+	if on.Month() < dob.Month() || (on.Month() == dob.Month() && on.Day() < dob.Day()) {
+		age--
+	}
+	return age
+}
@@ -0,0 +1,180 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ---- Practitioner names & registrations ---- */
+
+type registration struct {
+	Label  string
+	System string
+	Format *regexp.Regexp
+	Hint   string
+}
+
+// registrations maps each professional identifier type to its NHS
+// identifier system and the format the issuing body uses.
+var registrations = map[http.ProfessionalRegistrationType]registration{
+	http.Gphc:      {"GPhC number", "https://fhir.hl7.org.uk/Id/gphc-number", regexp.MustCompile(`^\d{7}$`), "7 digits"},
+	http.Gmc:       {"GMC number", "https://fhir.hl7.org.uk/Id/gmc-number", regexp.MustCompile(`^\d{7}$`), "7 digits"},
+	http.Nmc:       {"NMC PIN", "https://fhir.hl7.org.uk/Id/nmc-number", regexp.MustCompile(`^\d{2}[A-Z]\d{4}[A-Z]$`), "like 12A3456B"},
+	http.SdsUserId: {"SDS user ID", "https://fhir.nhs.uk/Id/sds-user-id", regexp.MustCompile(`^\d{12}$`), "12 digits"},
+}
+
+// registrationBySystem finds the registration type for an identifier system,
+// so free-form identifiers using an NHS system get the same format checks.
+func registrationBySystem(system string) (http.ProfessionalRegistrationType, bool) {
+	for t, r := range registrations {
+		if r.System == system {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// normaliseRegistration drops spaces and upper-cases letters; NMC PINs are
+// often written in lower case or with spaces.
+func normaliseRegistration(number string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(number), ""))
+}
+
+// validatePractitioners checks the names and identifiers of every clinician
+// in the request: the author, participants, performers and referral
+// requesters.
+func validatePractitioners(req http.UpdateRecordRequest) error {
+	problems := checkAuthor("provenance.author", &req.Provenance.Author)
+	if req.Provenance.Participants != nil {
+		for i, p := range *req.Provenance.Participants {
+			problems = append(problems, checkAuthor(fmt.Sprintf("provenance.participants[%d].practitioner", i), &p.Practitioner)...)
+		}
+	}
+	if req.Procedures != nil {
+		for i, p := range *req.Procedures {
+			problems = append(problems, checkAuthor(fmt.Sprintf("procedures[%d].performer", i), p.Performer)...)
+		}
+	}
+	if req.Immunizations != nil {
+		for i, im := range *req.Immunizations {
+			problems = append(problems, checkAuthor(fmt.Sprintf("immunizations[%d].performer", i), im.Performer)...)
+		}
+	}
+	if req.Referrals != nil {
+		for i, r := range *req.Referrals {
+			problems = append(problems, checkAuthor(fmt.Sprintf("referrals[%d].requester", i), r.Requester)...)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func checkAuthor(field string, a *http.Author) []string {
+	if a == nil {
+		return nil
+	}
+	var problems []string
+	if a.StructuredName != nil && strings.TrimSpace(a.StructuredName.Family) == "" {
+		problems = append(problems, field+".structuredName.family is required")
+	}
+	if a.Registrations != nil {
+		for i, r := range *a.Registrations {
+			reg, ok := registrations[r.Type]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s.registrations[%d].type %q must be one of gphc, gmc, nmc, sds-user-id", field, i, r.Type))
+				continue
+			}
+			if !reg.Format.MatchString(normaliseRegistration(r.Number)) {
+				problems = append(problems, fmt.Sprintf("%s.registrations[%d].number %q is not a valid %s number (%s)", field, i, r.Number, r.Type, reg.Hint))
+			}
+		}
+	}
+	if a.Identifiers != nil {
+		for i, id := range *a.Identifiers {
+			t, ok := registrationBySystem(id.System)
+			if ok && !registrations[t].Format.MatchString(normaliseRegistration(id.Value)) {
+				problems = append(problems, fmt.Sprintf("%s.identifiers[%d].value %q is not a valid %s number (%s)", field, i, id.Value, t, registrations[t].Hint))
+			}
+		}
+	}
+	return problems
+}
+
+// practitionerName uses the structured name when given, falling back to
+// splitting the display name.
+func practitionerName(a http.Author) HumanName {
+	if n := a.StructuredName; n != nil {
+		name := HumanName{Family: Text{Value: strings.TrimSpace(n.Family)}}
+		if n.Given != nil {
+			for _, g := range *n.Given {
+				if g = strings.TrimSpace(g); g != "" {
+					name.Given = append(name.Given, Text{Value: g})
+				}
+			}
+		}
+		if p := optTextPtr(n.Prefix); p != nil {
+			name.Prefix = []Text{*p}
+		}
+		if s := optTextPtr(n.Suffix); s != nil {
+			name.Suffix = []Text{*s}
+		}
+		return name
+	}
+	prefix, given, family := splitName(a.Name)
+	name := HumanName{Family: Text{Value: family}}
+	if given != "" {
+		name.Given = []Text{{Value: given}}
+	}
+	if prefix != "" {
+		name.Prefix = []Text{{Value: prefix}}
+	}
+	return name
+}
+
+// clinicianKey tells clinicians apart by their first professional
+// registration; two people can share a name. Only without one does the
+// name stand in.
+func clinicianKey(a http.Author) string {
+	for _, id := range practitionerIdentifiers(a) {
+		if _, ok := registrationBySystem(id.System.Value); ok {
+			return id.System.Value + "|" + id.Value.Value
+		}
+	}
+	return strings.TrimSpace(a.Name)
+}
+
+// practitionerIdentifiers lists registrations under their NHS systems, then
+// any other identifiers supplied. The legacy professional code isn't
+// recorded: it doesn't say which register it's from.
+func practitionerIdentifiers(a http.Author) []Identifier {
+	ids := []Identifier{}
+	seen := map[string]bool{}
+	add := func(system, value string) {
+		if seen[system+"|"+value] {
+			return
+		}
+		seen[system+"|"+value] = true
+		ids = append(ids, Identifier{System: Attr{Value: system}, Value: Attr{Value: value}})
+	}
+	if a.Registrations != nil {
+		for _, r := range *a.Registrations {
+			add(registrations[r.Type].System, normaliseRegistration(r.Number))
+		}
+	}
+	if a.Identifiers != nil {
+		for _, i := range *a.Identifiers {
+			value := i.Value
+			if _, ok := registrationBySystem(i.System); ok {
+				value = normaliseRegistration(value)
+			}
+			add(i.System, value)
+		}
+	}
+	return ids
+}
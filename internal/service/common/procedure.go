@@ -0,0 +1,108 @@
+package common
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ---- Procedure ---- */
+
+type Procedure struct {
+	XMLName    xml.Name        `xml:"Procedure"`
+	ID         Attr            `xml:"id"`
+	Meta       Meta            `xml:"meta"`
+	Text       *Narrative      `xml:"text,omitempty"`
+	Identifier []Identifier    `xml:"identifier"`
+	Status     Text            `xml:"status"`
+	Code       CodeableConcept `xml:"code"`
+	Subject    struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"subject"`
+	Context struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"context"`
+	PerformedDateTime Text                 `xml:"performedDateTime"`
+	Performer         []ProcedurePerformer `xml:"performer"`
+	BodySite          []CodeableConcept    `xml:"bodySite,omitempty"`
+	Outcome           *CodeableConcept     `xml:"outcome,omitempty"`
+	Note              []Annotation         `xml:"note,omitempty"`
+}
+
+type ProcedurePerformer struct {
+	XMLName xml.Name `xml:"performer"`
+	Actor   struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"actor"`
+}
+
+type Annotation struct {
+	XMLName xml.Name `xml:"note"`
+	Text    Text     `xml:"text"`
+}
+
+// validateProcedures checks each procedure is coded and, when given a
+// performer, that the performer is named.
+func validateProcedures(req http.UpdateRecordRequest) error {
+	if req.Procedures == nil {
+		return nil
+	}
+	var problems []string
+	for i, p := range *req.Procedures {
+		if p.Code.System == "" || p.Code.Code == "" {
+			problems = append(problems, fmt.Sprintf("procedures[%d].code needs a system and code", i))
+		}
+		if p.PerformedDateTime.IsZero() {
+			problems = append(problems, fmt.Sprintf("procedures[%d].performedDateTime is required", i))
+		}
+		if p.Performer != nil && strings.TrimSpace(p.Performer.Name) == "" {
+			problems = append(problems, fmt.Sprintf("procedures[%d].performer.name is required", i))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func makeProcedure(id string, ident Identifier, p http.ProcedureInput, patientID, encounterID, performerID, lastUpdated string) Procedure {
+	status := http.Completed
+	if p.Status != nil {
+		status = *p.Status
+	}
+	out := Procedure{
+		ID:                Attr{Value: trimURN(id)},
+		Meta:              Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.hl7.org.uk/STU3/StructureDefinition/CareConnect-Procedure-1"}},
+		Identifier:        []Identifier{ident},
+		Status:            Text{Value: string(status)},
+		Code:              codedToCC(p.Code),
+		PerformedDateTime: Text{Value: fhirDateTime(p.PerformedDateTime)},
+	}
+	out.Subject.Reference = Reference{RefValue: idRef(patientID)}
+	out.Context.Reference = Reference{RefValue: idRef(encounterID)}
+	performer := ProcedurePerformer{}
+	performer.Actor.Reference = Reference{RefValue: idRef(performerID)}
+	out.Performer = []ProcedurePerformer{performer}
+	if p.BodySite != nil {
+		out.BodySite = []CodeableConcept{codedToCC(*p.BodySite)}
+	}
+	if p.Outcome != nil {
+		cc := codedToCC(*p.Outcome)
+		out.Outcome = &cc
+	}
+	if p.Note != nil && strings.TrimSpace(*p.Note) != "" {
+		out.Note = []Annotation{{Text: Text{Value: *p.Note}}}
+	}
+	return out
+}
+
+// procedureHeading files a procedure under its heading tag, or procedures.
+func procedureHeading(p http.ProcedureInput) string {
+	if p.HeadingTag != nil {
+		return p.HeadingTag.Code
+	}
+	return headingProcedures
+}
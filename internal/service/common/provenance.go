@@ -0,0 +1,147 @@
+package common
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ---- Device (the sending system) & Provenance ---- */
+
+const asidSystem = "https://fhir.nhs.uk/Id/nhsSpineASID"
+
+// sourceASIDExtension carries the sending system's ASID on
+// MessageHeader.source; STU3 has no element for it and no NHS extension
+// covers it, so it is the provider's own, like the identifier systems.
+const sourceASIDExtension = "https://fhir.provider.example/StructureDefinition/Extension-SourceASID"
+
+// SourceExtension is an extension on MessageHeader.source.
+type SourceExtension struct {
+	XMLName         xml.Name         `xml:"extension"`
+	URL             string           `xml:"url,attr"`
+	ValueIdentifier *ValueIdentifier `xml:"valueIdentifier,omitempty"`
+}
+
+// ValueIdentifier is an extension value; Identifier can't be reused as it
+// names its own element.
+type ValueIdentifier struct {
+	System Attr `xml:"system"`
+	Value  Attr `xml:"value"`
+}
+
+type Device struct {
+	XMLName      xml.Name     `xml:"Device"`
+	ID           Attr         `xml:"id"`
+	Meta         Meta         `xml:"meta"`
+	Text         *Narrative   `xml:"text,omitempty"`
+	Identifier   []Identifier `xml:"identifier"`
+	Status       Text         `xml:"status"`
+	Manufacturer *Text        `xml:"manufacturer,omitempty"`
+	Model        Text         `xml:"model"`
+	Version      *Text        `xml:"version,omitempty"`
+	Owner        struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"owner"`
+}
+
+type ProvenanceXML struct {
+	XMLName xml.Name   `xml:"Provenance"`
+	ID      Attr       `xml:"id"`
+	Meta    Meta       `xml:"meta"`
+	Text    *Narrative `xml:"text,omitempty"`
+	Target  []struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"target"`
+	Recorded  Text              `xml:"recorded"`
+	Agent     []ProvenanceAgent `xml:"agent"`
+	Signature []Signature       `xml:"signature"`
+}
+
+type ProvenanceAgent struct {
+	Role         []CodeableConcept `xml:"role"`
+	WhoReference struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"whoReference"`
+	OnBehalfOfReference *struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"onBehalfOfReference,omitempty"`
+}
+
+type Signature struct {
+	Type         []SignatureType `xml:"type"`
+	When         Text            `xml:"when"`
+	WhoReference struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"whoReference"`
+}
+
+// SignatureType is a Coding; Coding can't be reused as it names its own element.
+type SignatureType struct {
+	System  Attr  `xml:"system"`
+	Code    Attr  `xml:"code"`
+	Display *Attr `xml:"display,omitempty"`
+}
+
+// makeDevice records the pharmacy system, identified by its ASID and owned by
+// the organisation sending the update. STU3 Device has no name, so the system
+// name goes in model.
+func makeDevice(id string, sys http.SystemProvenance, orgID, lastUpdated string) Device {
+	d := Device{
+		ID:           Attr{Value: trimURN(id)},
+		Meta:         Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "http://hl7.org/fhir/StructureDefinition/Device"}},
+		Status:       Text{Value: "active"},
+		Manufacturer: optTextPtr(sys.Manufacturer),
+		Model:        Text{Value: sys.Name},
+		Version:      optTextPtr(sys.Version),
+	}
+	if sys.Asid != nil {
+		d.Identifier = []Identifier{{System: Attr{Value: asidSystem}, Value: Attr{Value: strings.TrimSpace(*sys.Asid)}}}
+	}
+	d.Owner.Reference = Reference{RefValue: idRef(orgID)}
+	return d
+}
+
+// makeProvenance records that the author, acting for the organisation,
+// signed off the Composition using the device. signedAt defaults to the
+// build time.
+func makeProvenance(id, compositionID, authorID, orgID, deviceID string, signedAt *time.Time, now time.Time, lastUpdated string) ProvenanceXML {
+	when := now
+	if signedAt != nil {
+		when = *signedAt
+	}
+	author := ProvenanceAgent{Role: []CodeableConcept{participationType("AUT", "author (originator)")}}
+	author.WhoReference.Reference = Reference{RefValue: idRef(authorID)}
+	author.OnBehalfOfReference = &struct {
+		Reference Reference `xml:"reference"`
+	}{Reference: Reference{RefValue: idRef(orgID)}}
+	device := ProvenanceAgent{Role: []CodeableConcept{participationType("DEV", "device")}}
+	device.WhoReference.Reference = Reference{RefValue: idRef(deviceID)}
+
+	sig := Signature{
+		Type: []SignatureType{{
+			System:  Attr{Value: "urn:iso-astm:E1762-95:2013"},
+			Code:    Attr{Value: "1.2.840.10065.1.12.1.1"},
+			Display: &Attr{Value: "Author's Signature"},
+		}},
+		When: Text{Value: fhirDateTime(when)},
+	}
+	sig.WhoReference.Reference = Reference{RefValue: idRef(authorID)}
+
+	p := ProvenanceXML{
+		ID:        Attr{Value: trimURN(id)},
+		Meta:      Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "http://hl7.org/fhir/StructureDefinition/Provenance"}},
+		Recorded:  Text{Value: lastUpdated},
+		Agent:     []ProvenanceAgent{author, device},
+		Signature: []Signature{sig},
+	}
+	p.Target = []struct {
+		Reference Reference `xml:"reference"`
+	}{{Reference: Reference{RefValue: idRef(compositionID)}}}
+	return p
+}
+
+func participationType(code, display string) CodeableConcept {
+	return codedToCC(http.CodedItem{System: "http://hl7.org/fhir/v3/ParticipationType", Code: code, Display: &display})
+}
@@ -0,0 +1,141 @@
+package common
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ---- ReferralRequest ---- */
+
+type ReferralRequest struct {
+	XMLName          xml.Name         `xml:"ReferralRequest"`
+	ID               Attr             `xml:"id"`
+	Meta             Meta             `xml:"meta"`
+	Text             *Narrative       `xml:"text,omitempty"`
+	Identifier       []Identifier     `xml:"identifier"`
+	Status           Text             `xml:"status"`
+	Intent           Text             `xml:"intent"`
+	Priority         Text             `xml:"priority"`
+	ServiceRequested *CodeableConcept `xml:"serviceRequested,omitempty"`
+	Subject          struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"subject"`
+	Context struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"context"`
+	OccurrencePeriod struct {
+		Start Text  `xml:"start"`
+		End   *Text `xml:"end,omitempty"`
+	} `xml:"occurrencePeriod"`
+	AuthoredOn Text              `xml:"authoredOn"`
+	Requester  ReferralRequester `xml:"requester"`
+	Recipient  []struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"recipient"`
+	ReasonCode  []CodeableConcept `xml:"reasonCode"`
+	Description *Text             `xml:"description,omitempty"`
+}
+
+type ReferralRequester struct {
+	Agent struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"agent"`
+	OnBehalfOf struct {
+		Reference Reference `xml:"reference"`
+	} `xml:"onBehalfOf"`
+}
+
+var referralPriorities = map[http.ReferralInputPriority]bool{
+	http.Routine: true, http.Urgent: true, http.Asap: true, http.Stat: true,
+}
+
+// validateReferrals checks each referral has a priority, reason and
+// recipient, and exactly one way of saying when it is due.
+func validateReferrals(req http.UpdateRecordRequest) error {
+	if req.Referrals == nil {
+		return nil
+	}
+	var problems []string
+	for i, r := range *req.Referrals {
+		field := fmt.Sprintf("referrals[%d]", i)
+		if !referralPriorities[r.Priority] {
+			problems = append(problems, fmt.Sprintf("%s.priority %q must be one of routine, urgent, asap, stat", field, r.Priority))
+		}
+		if r.Reason.System == "" || r.Reason.Code == "" {
+			problems = append(problems, field+".reason needs a system and code")
+		}
+		if strings.TrimSpace(r.RecipientODS) == "" {
+			problems = append(problems, field+".recipientODS is required")
+		}
+		switch {
+		case r.DueBy == nil && r.DueWithinDays == nil:
+			problems = append(problems, field+" needs dueBy or dueWithinDays")
+		case r.DueBy != nil && r.DueWithinDays != nil:
+			problems = append(problems, field+" must not set both dueBy and dueWithinDays")
+		case r.DueWithinDays != nil && *r.DueWithinDays < 1:
+			problems = append(problems, field+".dueWithinDays must be at least 1")
+		case r.DueBy != nil && r.AuthoredOn != nil && !r.DueBy.After(*r.AuthoredOn):
+			problems = append(problems, field+".dueBy must be after authoredOn")
+		}
+		if r.Requester != nil && strings.TrimSpace(r.Requester.Name) == "" {
+			problems = append(problems, field+".requester.name is required")
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// makeReferralRequest builds an active order addressed to recipientID. The
+// due-by period runs from authoredOn (the build time when not supplied).
+func makeReferralRequest(id string, ident Identifier, r http.ReferralInput, patientID, encounterID, requesterID, orgID, recipientID string, now time.Time, lastUpdated string) ReferralRequest {
+	authored := now
+	if r.AuthoredOn != nil {
+		authored = *r.AuthoredOn
+	}
+	due := authored
+	if r.DueBy != nil {
+		due = *r.DueBy
+	} else if r.DueWithinDays != nil {
+		due = authored.AddDate(0, 0, *r.DueWithinDays)
+	}
+	out := ReferralRequest{
+		ID:          Attr{Value: trimURN(id)},
+		Meta:        Meta{LastUpdated: Attr{Value: lastUpdated}, Profile: Attr{Value: "https://fhir.hl7.org.uk/STU3/StructureDefinition/CareConnect-ReferralRequest-1"}},
+		Identifier:  []Identifier{ident},
+		Status:      Text{Value: "active"},
+		Intent:      Text{Value: "order"},
+		Priority:    Text{Value: string(r.Priority)},
+		AuthoredOn:  Text{Value: fhirDateTime(authored)},
+		ReasonCode:  []CodeableConcept{codedToCC(r.Reason)},
+		Description: optTextPtr(r.Description),
+	}
+	if r.ServiceRequested != nil {
+		cc := codedToCC(*r.ServiceRequested)
+		out.ServiceRequested = &cc
+	}
+	out.OccurrencePeriod.Start = Text{Value: fhirDateTime(authored)}
+	out.OccurrencePeriod.End = &Text{Value: fhirDateTime(due)}
+	out.Subject.Reference = Reference{RefValue: idRef(patientID)}
+	out.Context.Reference = Reference{RefValue: idRef(encounterID)}
+	out.Requester.Agent.Reference = Reference{RefValue: idRef(requesterID)}
+	out.Requester.OnBehalfOf.Reference = Reference{RefValue: idRef(orgID)}
+	out.Recipient = []struct {
+		Reference Reference `xml:"reference"`
+	}{{Reference: Reference{RefValue: idRef(recipientID)}}}
+	return out
+}
+
+// referralHeading files a referral under its heading tag, or referrals.
+func referralHeading(r http.ReferralInput) string {
+	if r.HeadingTag != nil {
+		return r.HeadingTag.Code
+	}
+	return headingReferrals
+}
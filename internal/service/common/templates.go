@@ -0,0 +1,265 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+/* ------------ Service templates ------------- */
+
+// ServiceTemplate turns the simple values of a ServiceInput into the coded
+// parts of an UpdateRecordRequest (composition type, encounter reason and
+// observations), so clients don't have to assemble SNOMED codes themselves.
+type ServiceTemplate struct {
+	Service http.CodedItem // used for composition.type and encounter.reasonCode
+	Title   string
+	Expand  func(req *http.UpdateRecordRequest, v http.ServiceValues, at time.Time) error
+}
+
+var serviceTemplates = map[http.ServiceInputTemplate]ServiceTemplate{
+	http.BloodPressureCheck: {
+		Service: snomed("1659111000000107", "Community Pharmacy Blood Pressure Check Service"),
+		Title:   "Community Pharmacy Blood Pressure Check Service",
+		Expand:  expandBloodPressureCheck,
+	},
+	http.Contraception: {
+		Service: snomed("1659121000000101", "Community Pharmacy Contraception Service"),
+		Title:   "Community Pharmacy Contraception Service",
+		Expand:  expandContraception,
+	},
+	http.PharmacyFirst: {
+		Service: snomed("1577041000000109", "Community Pharmacist Consultation Service for minor illness"),
+		Title:   "Pharmacy First",
+		Expand:  expandPharmacyFirst,
+	},
+}
+
+// ExpandServiceTemplate applies req.Service (if any) and returns the fully
+// coded request. Anything the client already supplied explicitly wins over
+// the template defaults; template observations are appended.
+func ExpandServiceTemplate(req http.UpdateRecordRequest) (http.UpdateRecordRequest, error) {
+	if req.Service == nil {
+		return req, nil
+	}
+	tpl, ok := serviceTemplates[req.Service.Template]
+	if !ok {
+		return req, fmt.Errorf("service.template %q is not supported", req.Service.Template)
+	}
+
+	primary, _ := resolveEncounters(req)
+	at := time.Time{}
+	switch {
+	case req.Service.TakenAt != nil:
+		at = *req.Service.TakenAt
+	case primary.OccurredAt != nil:
+		at = *primary.OccurredAt
+	default:
+		return req, errors.New("service.takenAt or encounter.occurredAt is required when using a service template")
+	}
+
+	// composition (copied so the caller's request is left untouched)
+	comp := http.CompositionDetails{}
+	if req.Composition != nil {
+		comp = *req.Composition
+	}
+	if comp.Type == nil {
+		svc := tpl.Service
+		comp.Type = &svc
+	}
+	if comp.Title == nil {
+		title := tpl.Title
+		comp.Title = &title
+	}
+	req.Composition = &comp
+
+	// encounter
+	if req.Encounter == nil && req.Encounters == nil {
+		req.Encounter = &http.Encounter{OccurredAt: &at}
+	}
+	if req.Encounter != nil && req.Encounter.ReasonCode == nil && req.Encounter.Reason == nil {
+		enc := *req.Encounter
+		svc := tpl.Service
+		enc.ReasonCode = &svc
+		req.Encounter = &enc
+	}
+	if req.Encounters != nil {
+		encounters := append([]http.EncounterWithRole(nil), *req.Encounters...)
+		for i, e := range encounters {
+			if e.ReasonCode == nil && e.Reason == nil {
+				svc := tpl.Service
+				encounters[i].ReasonCode = &svc
+			}
+		}
+		req.Encounters = &encounters
+	}
+
+	var v http.ServiceValues
+	if req.Service.Values != nil {
+		v = *req.Service.Values
+	}
+	if err := tpl.Expand(&req, v, at); err != nil {
+		return req, fmt.Errorf("service %s: %w", req.Service.Template, err)
+	}
+	return req, nil
+}
+
+func expandBloodPressureCheck(req *http.UpdateRecordRequest, v http.ServiceValues, at time.Time) error {
+	if v.Systolic == nil || v.Diastolic == nil {
+		return errors.New("values.systolic and values.diastolic are required")
+	}
+	addObservation(req, bloodPressureObservation(*v.Systolic, *v.Diastolic, v.Arm, at))
+	if v.HeartRate != nil {
+		addObservation(req, vitalSign(snomed("364075005", "Heart rate"), *v.HeartRate, "per minute", "/min", at))
+	}
+	return nil
+}
+
+func expandContraception(req *http.UpdateRecordRequest, v http.ServiceValues, at time.Time) error {
+	if v.Systolic == nil || v.Diastolic == nil {
+		return errors.New("values.systolic and values.diastolic are required")
+	}
+	if v.SupplyMade == nil {
+		return errors.New("values.supplyMade is required")
+	}
+	addObservation(req, bloodPressureObservation(*v.Systolic, *v.Diastolic, v.Arm, at))
+	if v.HeightCm != nil {
+		addObservation(req, vitalSign(snomed("50373000", "Body height measure"), *v.HeightCm, "centimeter", "cm", at))
+	}
+	if v.WeightKg != nil {
+		addObservation(req, vitalSign(snomed("27113001", "Body weight"), *v.WeightKg, "kilogram", "kg", at))
+	}
+	if v.Pregnant != nil {
+		status := snomed("60001007", "Not pregnant")
+		if *v.Pregnant {
+			status = snomed("77386006", "Pregnant")
+		}
+		addObservation(req, http.ObservationInput{
+			Status:            http.Final,
+			Category:          observationCategory("social-history", "Social History"),
+			Code:              status,
+			EffectiveDateTime: at,
+			HeadingTag:        heading(headingPregnancyStatus),
+		})
+	}
+
+	if v.Medication == nil {
+		if *v.SupplyMade {
+			return errors.New("values.medication is required when values.supplyMade is true")
+		}
+		return nil
+	}
+	if v.Medication.Display == nil {
+		return errors.New("values.medication.display is required")
+	}
+	status := http.MedicationSuppliedStatusCompleted
+	if !*v.SupplyMade {
+		status = http.MedicationSuppliedStatusDeclined
+	}
+	supplied := http.MedicationSupplied{Status: status, Medication: *v.Medication}
+	req.ClinicalSummary.MedicationsSupplied = appendTo(req.ClinicalSummary.MedicationsSupplied, supplied)
+	return nil
+}
+
+func expandPharmacyFirst(req *http.UpdateRecordRequest, v http.ServiceValues, at time.Time) error {
+	// Pharmacy First carries no fixed readings; vitals are optional.
+	if v.Systolic != nil && v.Diastolic != nil {
+		addObservation(req, bloodPressureObservation(*v.Systolic, *v.Diastolic, v.Arm, at))
+	}
+	if v.HeartRate != nil {
+		addObservation(req, vitalSign(snomed("364075005", "Heart rate"), *v.HeartRate, "per minute", "/min", at))
+	}
+	return nil
+}
+
+/* ---- template helpers ---- */
+
+// addObservation appends a generated observation. Its id comes from its
+// code, so rebuilding or amending the request finds the same observation.
+func addObservation(req *http.UpdateRecordRequest, ob http.ObservationInput) {
+	var obs []http.ObservationInput
+	if req.Observations != nil {
+		obs = *req.Observations
+	}
+	ob.Id = generatedID(obs, ob.Code)
+	req.Observations = appendTo(req.Observations, ob)
+}
+
+// generatedID names a generated observation by its code, numbered when an
+// observation already has that id.
+func generatedID(obs []http.ObservationInput, code http.CodedItem) string {
+	taken := map[string]bool{}
+	for _, o := range obs {
+		taken[o.Id] = true
+	}
+	base := "generated/" + code.System + "|" + code.Code
+	id := base
+	for n := 2; taken[id]; n++ {
+		id = fmt.Sprintf("%s/%d", base, n)
+	}
+	return id
+}
+
+// appendTo returns a new slice rather than appending in place, so expanding a
+// request never writes through to the slices of the caller's copy.
+func appendTo[T any](s *[]T, items ...T) *[]T {
+	var out []T
+	if s != nil {
+		out = append(out, *s...)
+	}
+	out = append(out, items...)
+	return &out
+}
+
+func bloodPressureObservation(systolic, diastolic json.Number, arm *http.ServiceValuesArm, at time.Time) http.ObservationInput {
+	ob := http.ObservationInput{
+		Status:            http.Final,
+		Category:          observationCategory("vital-signs", "Vital Signs"),
+		Code:              snomed("163020007", "O/E - blood pressure reading"),
+		EffectiveDateTime: at,
+		Components: &[]http.ObservationComponent{
+			{Code: snomed("72313002", "Systolic arterial pressure"), ValueQuantity: ucumQuantity(systolic, "millimeter of mercury", "mm[Hg]")},
+			{Code: snomed("271650006", "Diastolic blood pressure"), ValueQuantity: ucumQuantity(diastolic, "millimeter of mercury", "mm[Hg]")},
+		},
+	}
+	if arm != nil {
+		site := snomed("368209003", "Right upper arm structure")
+		if *arm == http.Left {
+			site = snomed("368208006", "Left upper arm structure")
+		}
+		ob.BodySite = &site
+	}
+	return ob
+}
+
+// vitalSign builds a single-value vital sign observation.
+func vitalSign(code http.CodedItem, value json.Number, unit, ucum string, at time.Time) http.ObservationInput {
+	return http.ObservationInput{
+		Status:            http.Final,
+		Category:          observationCategory("vital-signs", "Vital Signs"),
+		Code:              code,
+		EffectiveDateTime: at,
+		ValueQuantity:     ucumQuantity(value, unit, ucum),
+	}
+}
+
+func snomed(code, display string) http.CodedItem {
+	return http.CodedItem{System: "http://snomed.info/sct", Code: code, Display: &display, Text: &display}
+}
+
+func observationCategory(code, display string) *http.CodedItem {
+	return &http.CodedItem{
+		System:  "http://terminology.hl7.org/CodeSystem/observation-category",
+		Code:    code,
+		Display: &display,
+		Text:    &display,
+	}
+}
+
+func ucumQuantity(value json.Number, unit, code string) *http.Quantity {
+	system := "http://unitsofmeasure.org"
+	return &http.Quantity{Value: value, Unit: &unit, System: &system, Code: &code}
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Cleo-Systems/elevate-gpconnect/client/http"
+)
+
+func TestServiceTemplateReasonOnEveryEncounter(t *testing.T) {
+	var req http.UpdateRecordRequest
+	if err := json.Unmarshal([]byte(`{
+		"patient": {"nhsNumber": "9876543210"},
+		"service": {"template": "blood-pressure-check", "values": {"systolic": 128, "diastolic": 82}},
+		"encounters": [
+			{"id": "e1", "role": "primary", "occurredAt": "2024-05-01T10:15:00+01:00"},
+			{"id": "e2", "occurredAt": "2024-05-01T10:45:00+01:00", "reason": "Follow-up"}
+		]
+	}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ExpandServiceTemplate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encounters := *got.Encounters
+	if rc := encounters[0].ReasonCode; rc == nil || rc.Code != serviceTemplates[http.BloodPressureCheck].Service.Code {
+		t.Errorf("primary encounter reasonCode %+v, want the service", rc)
+	}
+	if rc := encounters[1].ReasonCode; rc != nil {
+		t.Errorf("encounter with its own reason got reasonCode %+v", rc)
+	}
+	if (*req.Encounters)[0].ReasonCode != nil {
+		t.Error("the caller's encounters were changed")
+	}
+}
@@ -0,0 +1,29 @@
+package common
+
+import (
+	"time"
+	_ "time/tzdata" // Europe/London must resolve in minimal containers without zoneinfo
+)
+
+/* ------------ Time handling ------------- */
+
+// ukZone is the zone GP systems display clinical times in. Rendering in it
+// keeps a 00:30 BST consultation on the day the clinician recorded it.
+var ukZone = mustLoadZone("Europe/London")
+
+// fhirDateTimeLayout always writes an explicit offset (+00:00 in winter)
+// and keeps sub-second precision only when the source time has it.
+const fhirDateTimeLayout = "2006-01-02T15:04:05.999999999-07:00"
+
+func mustLoadZone(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// fhirDateTime renders t as a FHIR dateTime/instant in UK local time.
+func fhirDateTime(t time.Time) string {
+	return t.In(ukZone).Format(fhirDateTimeLayout)
+}
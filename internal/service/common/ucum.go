@@ -0,0 +1,170 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* ------------ UCUM unit validation ------------- */
+
+const ucumSystem = "http://unitsofmeasure.org"
+
+// ucumAtoms lists the unit atoms we accept, mapped to whether they are
+// metric (and may therefore take a prefix). It covers the units clinical
+// systems actually send rather than the whole UCUM table.
+var ucumAtoms = map[string]bool{
+	// base units
+	"m": true, "s": true, "g": true, "rad": true, "K": true, "C": true, "cd": true,
+	// derived SI
+	"mol": true, "sr": true, "Hz": true, "N": true, "Pa": true, "J": true, "W": true,
+	"A": true, "V": true, "F": true, "Ohm": true, "S": true, "Wb": true, "T": true,
+	"H": true, "lm": true, "lx": true, "Bq": true, "Gy": true, "Sv": true, "Cel": true,
+	"L": true, "l": true, "eq": true, "osm": true, "kat": true, "U": true, "bar": true,
+	"cal": true, "t": true, "[iU]": true, "[IU]": true,
+	"m[Hg]": true, "m[H2O]": true,
+	// time
+	"min": false, "h": false, "d": false, "wk": false, "mo": false, "a": false,
+	// imperial / avoirdupois
+	"[in_i]": false, "[ft_i]": false, "[yd_i]": false, "[mi_i]": false,
+	"[lb_av]": false, "[oz_av]": false, "[stone_av]": false, "[degF]": false,
+	"[in_i'Hg]": false,
+	// dimensionless and arbitrary
+	"%": false, "[ppm]": false, "[ppb]": false, "[pH]": false, "[drp]": false,
+	"[arb'U]": false, "[tsp_us]": false, "[tbs_us]": false, "[foz_us]": false,
+	"10*": false, "10^": false,
+}
+
+// ucumPrefixes are the metric prefixes; "da" comes first so it wins over "d".
+var ucumPrefixes = []string{"da", "Y", "Z", "E", "P", "T", "G", "M", "k", "h", "d", "c", "m", "u", "n", "p", "f", "a", "z", "y"}
+
+// validateUCUM checks that code is a syntactically valid UCUM expression
+// built from known atoms, e.g. "mm[Hg]", "kg/m2", "{beats}/min", "10*9/L".
+func validateUCUM(code string) error {
+	if strings.TrimSpace(code) == "" {
+		return fmt.Errorf("empty UCUM code")
+	}
+	p := &ucumParser{in: code}
+	if p.peek() == '/' {
+		p.pos++
+	}
+	if err := p.term(); err != nil {
+		return fmt.Errorf("invalid UCUM code %q: %w", code, err)
+	}
+	if p.pos != len(p.in) {
+		return fmt.Errorf("invalid UCUM code %q: unexpected %q at %d", code, p.in[p.pos], p.pos)
+	}
+	return nil
+}
+
+type ucumParser struct {
+	in  string
+	pos int
+}
+
+func (p *ucumParser) peek() byte {
+	if p.pos >= len(p.in) {
+		return 0
+	}
+	return p.in[p.pos]
+}
+
+// term := component (('.' | '/') component)*
+func (p *ucumParser) term() error {
+	if err := p.component(); err != nil {
+		return err
+	}
+	for c := p.peek(); c == '.' || c == '/'; c = p.peek() {
+		p.pos++
+		if err := p.component(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// component := annotatable annotation? | annotation | factor | '(' term ')'
+func (p *ucumParser) component() error {
+	switch c := p.peek(); {
+	case c == 0:
+		return fmt.Errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		if err := p.term(); err != nil {
+			return err
+		}
+		if p.peek() != ')' {
+			return fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return nil
+	case c == '{':
+		return p.annotation()
+	case isDigit(c) && !strings.HasPrefix(p.in[p.pos:], "10*") && !strings.HasPrefix(p.in[p.pos:], "10^"):
+		for isDigit(p.peek()) {
+			p.pos++
+		}
+		return nil
+	}
+
+	if err := p.simpleUnit(); err != nil {
+		return err
+	}
+	// exponent
+	if c := p.peek(); c == '+' || c == '-' {
+		p.pos++
+	}
+	for isDigit(p.peek()) {
+		p.pos++
+	}
+	if p.peek() == '{' {
+		return p.annotation()
+	}
+	return nil
+}
+
+func (p *ucumParser) annotation() error {
+	end := strings.IndexByte(p.in[p.pos:], '}')
+	if end < 0 {
+		return fmt.Errorf("unterminated annotation")
+	}
+	p.pos += end + 1
+	return nil
+}
+
+func (p *ucumParser) simpleUnit() error {
+	start := p.pos
+	if strings.HasPrefix(p.in[p.pos:], "10*") || strings.HasPrefix(p.in[p.pos:], "10^") {
+		p.pos += 3
+		return nil
+	}
+	for {
+		c := p.peek()
+		if c == '[' {
+			end := strings.IndexByte(p.in[p.pos:], ']')
+			if end < 0 {
+				return fmt.Errorf("unterminated '['")
+			}
+			p.pos += end + 1
+			continue
+		}
+		if c == 0 || c == '.' || c == '/' || c == '(' || c == ')' || c == '{' || c == '+' || c == '-' || isDigit(c) {
+			break
+		}
+		p.pos++
+	}
+	sym := p.in[start:p.pos]
+	if sym == "" {
+		return fmt.Errorf("expected a unit at %d", start)
+	}
+	if _, ok := ucumAtoms[sym]; ok {
+		return nil
+	}
+	for _, pre := range ucumPrefixes {
+		if rest, ok := strings.CutPrefix(sym, pre); ok && ucumAtoms[rest] {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown unit %q", sym)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
@@ -0,0 +1,52 @@
+package common
+
+import "testing"
+
+func TestValidateUCUM(t *testing.T) {
+	tests := []struct {
+		code  string
+		valid bool
+	}{
+		{"mm[Hg]", true},
+		{"/min", true},
+		{"kg/m2", true},
+		{"kg.m-2", true},
+		{"10*9/L", true},
+		{"10^12/L", true},
+		{"{breaths}/min", true},
+		{"{beats}/min", true},
+		{"Cel", true},
+		{"[degF]", true},
+		{"%", true},
+		{"mmol/L", true},
+		{"ug", true},
+		{"dam", true},
+		{"[lb_av]", true},
+		{"[in_i'Hg]", true},
+		{"mL/(kg.min)", true},
+		{"[iU]/L", true},
+		{"1", true},
+		{"mg{total}", true},
+
+		{"", false},
+		{"  ", false},
+		{"mmHg", false},
+		{"bpm", false},
+		{"Kg", false},
+		{"kg m2", false},
+		{"kg/", false},
+		{"kg//m2", false},
+		{"(kg", false},
+		{"cm)", false},
+		{"{breaths", false},
+		{"[in_i", false},
+		{"/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if err := validateUCUM(tt.code); (err == nil) != tt.valid {
+				t.Errorf("validateUCUM(%q) = %v, want valid %v", tt.code, err, tt.valid)
+			}
+		})
+	}
+}
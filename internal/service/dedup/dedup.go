@@ -0,0 +1,78 @@
+// Package dedup spots messages whose clinical content was already sent,
+// whatever Idempotency-Key they came with.
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// Actions taken on a likely duplicate.
+const (
+	Reject = "reject" // refuse it with DUPLICATE_SUBMISSION
+	Flag   = "flag"   // send it, marked as a duplicate of the original
+	Off    = "off"    // don't check
+)
+
+// Match is the earlier message a fingerprint was seen on.
+type Match struct {
+	MessageID string
+	SeenAt    time.Time
+}
+
+// Index remembers content fingerprints per client. Entries older than the
+// window no longer match and are dropped as the index grows.
+type Index struct {
+	mu     sync.Mutex
+	window time.Duration    // as of the last Claim, for pruning
+	m      map[string]Match // client|fingerprint -> first message
+	sweep  int              // size at which expired entries are next dropped
+}
+
+func NewIndex() *Index {
+	return &Index{m: map[string]Match{}, sweep: 1024}
+}
+
+// Claim records messageID against the fingerprint unless a message within
+// window already has it, in which case that one is returned. The window is
+// passed per call so a config reload applies at once. Checking
+// and recording together means two concurrent resends can't both pass.
+// current reports whether an earlier message still counts; one that was
+// retracted doesn't, and is replaced by messageID.
+func (x *Index) Claim(clientID, fingerprint, messageID string, window time.Duration, current func(messageID string) bool) (Match, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	now := time.Now()
+	x.window = window
+	key := clientID + "|" + fingerprint
+	if prev, ok := x.m[key]; ok && now.Sub(prev.SeenAt) <= x.window && current(prev.MessageID) {
+		return prev, true
+	}
+	x.m[key] = Match{MessageID: messageID, SeenAt: now}
+	x.prune(now)
+	return Match{}, false
+}
+
+// Release forgets a claim whose message was never sent.
+func (x *Index) Release(clientID, fingerprint, messageID string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	key := clientID + "|" + fingerprint
+	if x.m[key].MessageID == messageID {
+		delete(x.m, key)
+	}
+}
+
+// prune drops expired entries each time the index doubles, so memory stays
+// in proportion to the traffic within one window.
+func (x *Index) prune(now time.Time) {
+	if len(x.m) < x.sweep {
+		return
+	}
+	for k, m := range x.m {
+		if now.Sub(m.SeenAt) > x.window {
+			delete(x.m, k)
+		}
+	}
+	x.sweep = 2*len(x.m) + 1024
+}
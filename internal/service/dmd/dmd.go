@@ -0,0 +1,143 @@
+// Package dmd validates medicine codes against a local copy of the NHS
+// Dictionary of Medicines and Devices (dm+d) XML release.
+package dmd
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Concept levels in the dm+d model.
+const (
+	VTM  = "VTM"  // virtual therapeutic moiety
+	VMP  = "VMP"  // virtual medicinal product
+	AMP  = "AMP"  // actual medicinal product
+	VMPP = "VMPP" // virtual medicinal product pack
+	AMPP = "AMPP" // actual medicinal product pack
+)
+
+// Concept is one dm+d entry.
+type Concept struct {
+	ID      string
+	Name    string
+	Level   string
+	Invalid bool // flagged invalid in the release; must not be used
+}
+
+// Dictionary holds dm+d concepts keyed by SNOMED CT identifier. A nil
+// Dictionary is valid and finds nothing.
+type Dictionary struct {
+	concepts map[string]Concept
+}
+
+// record picks out the fields we use from any dm+d concept element; each
+// level names its identifier differently.
+type record struct {
+	VTMID   string `xml:"VTMID"`
+	VPID    string `xml:"VPID"`
+	APID    string `xml:"APID"`
+	VPPID   string `xml:"VPPID"`
+	APPID   string `xml:"APPID"`
+	NM      string `xml:"NM"`
+	DESC    string `xml:"DESC"`
+	INVALID string `xml:"INVALID"`
+}
+
+// LoadFile reads one or more dm+d release files (f_vtm2, f_vmp2, f_amp2,
+// f_vmpp2, f_ampp2) into a single Dictionary.
+func LoadFile(paths ...string) (*Dictionary, error) {
+	d := &Dictionary{concepts: map[string]Concept{}}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		err = d.load(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return d, nil
+}
+
+// LoadXML reads a single dm+d release file.
+func LoadXML(r io.Reader) (*Dictionary, error) {
+	d := &Dictionary{concepts: map[string]Concept{}}
+	if err := d.load(r); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// load streams the file so the multi-hundred-megabyte AMPP release doesn't
+// have to fit in memory as a tree.
+func (d *Dictionary) load(r io.Reader) error {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		level := se.Name.Local
+		switch level {
+		case VTM, VMP, AMP, VMPP, AMPP:
+		default:
+			continue
+		}
+		var rec record
+		if err := dec.DecodeElement(&rec, &se); err != nil {
+			return err
+		}
+		c := Concept{Level: level, Invalid: strings.TrimSpace(rec.INVALID) == "1"}
+		switch level {
+		case VTM:
+			c.ID = rec.VTMID
+		case VMP:
+			c.ID = rec.VPID
+		case AMP:
+			c.ID = rec.APID
+		case VMPP:
+			c.ID = rec.VPPID
+		case AMPP:
+			c.ID = rec.APPID
+		}
+		c.ID = strings.TrimSpace(c.ID)
+		if c.ID == "" {
+			continue
+		}
+		c.Name = strings.TrimSpace(rec.NM)
+		if c.Name == "" {
+			c.Name = strings.TrimSpace(rec.DESC)
+		}
+		d.concepts[c.ID] = c
+	}
+}
+
+// Lookup returns the concept for a dm+d identifier.
+func (d *Dictionary) Lookup(id string) (Concept, bool) {
+	if d == nil {
+		return Concept{}, false
+	}
+	c, ok := d.concepts[strings.TrimSpace(id)]
+	return c, ok
+}
+
+// Len reports how many concepts are loaded.
+func (d *Dictionary) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.concepts)
+}
@@ -0,0 +1,108 @@
+// Package messages records the messages the gateway has sent, so they can
+// be looked up later and amended or retracted.
+package messages
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Status is where a sent message stands.
+type Status string
+
+const (
+	Accepted       Status = "accepted"
+	Amended        Status = "amended"          // superseded by an amendment
+	EnteredInError Status = "entered-in-error" // retracted
+)
+
+// Record is one sent message.
+type Record struct {
+	MessageID    string
+	MessageType  string
+	ClientID     string // "" when running without tenants
+	Status       Status
+	Request      []byte            // request body as built, so a retraction can rebuild it
+	DocumentID   string            // document Bundle fullUrl
+	ResourceIDs  map[string]string // resource fullUrls by key
+	Amends       string            // message this one amends
+	Retracts     string            // message this one retracts
+	Reason       string            // why it was amended or retracted
+	SupersededBy string            // the amendment or retraction that replaced it
+	DuplicateOf  string            // earlier message with the same clinical content, when flagged
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Correctable reports whether the message can still be amended or
+// retracted: it is current, and not itself a retraction.
+func (r Record) Correctable() bool {
+	return r.Status == Accepted && r.Retracts == ""
+}
+
+var (
+	ErrNotFound       = errors.New("message not found")
+	ErrNotCorrectable = errors.New("message has been amended or retracted, or is itself a retraction")
+)
+
+// Store keeps message records.
+type Store interface {
+	Get(id string) (Record, error)
+	Put(r Record) error
+	// Supersede stores next and marks the original with status, atomically,
+	// failing with ErrNotCorrectable if the original was already replaced.
+	Supersede(originalID string, status Status, next Record) error
+}
+
+// Memory is a Store held in process memory; records are lost on restart.
+type Memory struct {
+	mu sync.Mutex
+	m  map[string]Record
+}
+
+func NewMemory() *Memory {
+	return &Memory{m: map[string]Record{}}
+}
+
+func (s *Memory) Get(id string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.m[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *Memory) Put(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = now
+	}
+	r.UpdatedAt = now
+	s.m[r.MessageID] = r
+	return nil
+}
+
+func (s *Memory) Supersede(originalID string, status Status, next Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orig, ok := s.m[originalID]
+	if !ok {
+		return ErrNotFound
+	}
+	if !orig.Correctable() {
+		return ErrNotCorrectable
+	}
+	now := time.Now()
+	orig.Status = status
+	orig.SupersededBy = next.MessageID
+	orig.UpdatedAt = now
+	s.m[originalID] = orig
+	next.CreatedAt, next.UpdatedAt = now, now
+	s.m[next.MessageID] = next
+	return nil
+}
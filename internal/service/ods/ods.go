@@ -0,0 +1,197 @@
+// Package ods resolves ODS organisation and site codes against a local copy
+// of the NHS Organisation Data Service extracts (epraccur.csv, ets.csv, ...).
+package ods
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Site is a single ODS record.
+type Site struct {
+	Code         string
+	Name         string
+	AddressLines []string
+	Town         string
+	County       string
+	Postcode     string
+	Phone        string
+	OpenDate     string // YYYYMMDD
+	CloseDate    string // YYYYMMDD, empty while open
+	Status       string // A active, C closed, D dormant, P proposed
+}
+
+// Active reports whether the organisation is open on the given day: status
+// active (or not given) and no close date on or before it.
+func (s Site) Active(on time.Time) bool {
+	if s.Status != "" && s.Status != "A" {
+		return false
+	}
+	if s.CloseDate == "" {
+		return true
+	}
+	closed, err := time.Parse("20060102", s.CloseDate)
+	if err != nil {
+		return true
+	}
+	return on.Before(closed)
+}
+
+// Directory is an in-memory ODS dataset keyed by code. A nil Directory is
+// valid and finds nothing. Directories loaded from files can be refreshed
+// in place with Reload while lookups continue.
+type Directory struct {
+	mu       sync.RWMutex
+	sites    map[string]Site
+	paths    []string
+	loadedAt time.Time
+}
+
+// Column positions in the standard ODS CSV layout (no header row).
+const (
+	colCode      = 0
+	colName      = 1
+	colAddress   = 4 // address lines 1-3 are 4-6
+	colTown      = 7
+	colCounty    = 8
+	colPostcode  = 9
+	colOpenDate  = 10
+	colCloseDate = 11
+	colStatus    = 12
+	colPhone     = 17
+)
+
+// LoadFile reads one or more ODS CSV extracts into a single Directory.
+// Later files win when a code appears twice.
+func LoadFile(paths ...string) (*Directory, error) {
+	sites, err := readFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	return &Directory{sites: sites, paths: paths, loadedAt: time.Now()}, nil
+}
+
+// LoadCSV reads an ODS CSV extract.
+func LoadCSV(r io.Reader) (*Directory, error) {
+	sites := map[string]Site{}
+	if err := load(sites, r); err != nil {
+		return nil, err
+	}
+	return &Directory{sites: sites, loadedAt: time.Now()}, nil
+}
+
+// Reload re-reads the files the Directory was loaded from, e.g. after the
+// weekly ODS extracts have been replaced. On error the current data is kept.
+func (d *Directory) Reload() error {
+	if d == nil || len(d.paths) == 0 {
+		return errors.New("ods: directory was not loaded from files")
+	}
+	sites, err := readFiles(d.paths)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.sites = sites
+	d.loadedAt = time.Now()
+	d.mu.Unlock()
+	return nil
+}
+
+// LoadedAt is when the data was last read.
+func (d *Directory) LoadedAt() time.Time {
+	if d == nil {
+		return time.Time{}
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.loadedAt
+}
+
+func readFiles(paths []string) (map[string]Site, error) {
+	sites := map[string]Site{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		err = load(sites, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return sites, nil
+}
+
+func load(sites map[string]Site, r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(rec) <= colPostcode {
+			return fmt.Errorf("line %d: expected at least %d columns, got %d", line, colPostcode+1, len(rec))
+		}
+		code := strings.ToUpper(strings.TrimSpace(rec[colCode]))
+		if code == "" {
+			continue
+		}
+		s := Site{
+			Code:      code,
+			Name:      field(rec, colName),
+			Town:      field(rec, colTown),
+			County:    field(rec, colCounty),
+			Postcode:  field(rec, colPostcode),
+			OpenDate:  field(rec, colOpenDate),
+			CloseDate: field(rec, colCloseDate),
+			Status:    field(rec, colStatus),
+			Phone:     field(rec, colPhone),
+		}
+		for i := colAddress; i < colTown; i++ {
+			if l := field(rec, i); l != "" {
+				s.AddressLines = append(s.AddressLines, l)
+			}
+		}
+		sites[code] = s
+	}
+}
+
+// Lookup returns the record for an ODS code.
+func (d *Directory) Lookup(code string) (Site, bool) {
+	if d == nil {
+		return Site{}, false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	s, ok := d.sites[strings.ToUpper(strings.TrimSpace(code))]
+	return s, ok
+}
+
+// Len reports how many records are loaded.
+func (d *Directory) Len() int {
+	if d == nil {
+		return 0
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.sites)
+}
+
+func field(rec []string, i int) string {
+	if i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
@@ -0,0 +1,234 @@
+// Package tenant maps authenticated API clients to the pharmacy groups
+// (tenants) they send for. Each tenant has its own MESH mailbox, ASID, ODS
+// codes and message defaults.
+package tenant
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Client is a caller of the API, identified by a bearer token. Only the
+// SHA-256 of the token is kept in configuration.
+type Client struct {
+	ID          string `json:"id" yaml:"id"`
+	TokenSHA256 string `json:"tokenSha256" yaml:"tokenSha256"`
+}
+
+// Tenant is a pharmacy group and the settings its messages are sent with.
+type Tenant struct {
+	ID                         string   `json:"id" yaml:"id"`
+	Clients                    []string `json:"clients" yaml:"clients"`   // client IDs allowed to send for this tenant
+	ODSCodes                   []string `json:"odsCodes" yaml:"odsCodes"` // performer ODS codes the tenant sends as
+	DefaultSenderODS           string   `json:"defaultSenderODS,omitempty" yaml:"defaultSenderODS,omitempty"`
+	MeshMailbox                string   `json:"meshMailbox" yaml:"meshMailbox"`
+	ASID                       string   `json:"asid" yaml:"asid"`
+	BusinessAckRequested       *bool    `json:"businessAckRequested,omitempty" yaml:"businessAckRequested,omitempty"`
+	InfrastructureAckRequested *bool    `json:"infrastructureAckRequested,omitempty" yaml:"infrastructureAckRequested,omitempty"`
+	RecipientType              string   `json:"recipientType,omitempty" yaml:"recipientType,omitempty"`       // e.g. "FI"
+	IdentifierSystem           string   `json:"identifierSystem,omitempty" yaml:"identifierSystem,omitempty"` // base for source IDs; the gateway's when empty
+}
+
+// File is the on-disk registry layout.
+type File struct {
+	Clients []Client `json:"clients" yaml:"clients"`
+	Tenants []Tenant `json:"tenants" yaml:"tenants"`
+}
+
+// ErrNoTenant is returned by Resolve when the client may not send for the
+// ODS code, or the code doesn't pick out a single tenant.
+var ErrNoTenant = errors.New("no tenant for sender")
+
+// Registry resolves clients and ODS codes to tenants. It is read-only once
+// built, so safe for concurrent use.
+type Registry struct {
+	tokens   map[[32]byte]string  // token hash -> client ID
+	byClient map[string][]*Tenant // client ID -> tenants in file order
+}
+
+var asidPattern = regexp.MustCompile(`^\d{12}$`)
+
+// LoadFile reads and validates a JSON registry file.
+func LoadFile(path string) (*Registry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Parse reads and validates a JSON registry.
+func Parse(r io.Reader) (*Registry, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	return New(f)
+}
+
+// New validates f and builds a Registry. Every problem found is reported,
+// not just the first.
+func New(f File) (*Registry, error) {
+	reg := &Registry{tokens: map[[32]byte]string{}, byClient: map[string][]*Tenant{}}
+	var problems []string
+
+	for i, c := range f.Clients {
+		field := fmt.Sprintf("clients[%d]", i)
+		id := strings.TrimSpace(c.ID)
+		if id == "" {
+			problems = append(problems, field+".id is required")
+			continue
+		}
+		if _, dup := reg.byClient[id]; dup {
+			problems = append(problems, fmt.Sprintf("%s.id %q is used more than once", field, id))
+			continue
+		}
+		reg.byClient[id] = nil
+		raw, err := hex.DecodeString(strings.TrimSpace(c.TokenSHA256))
+		if err != nil || len(raw) != sha256.Size {
+			problems = append(problems, field+".tokenSha256 must be a hex SHA-256 digest")
+			continue
+		}
+		var h [32]byte
+		copy(h[:], raw)
+		if other, dup := reg.tokens[h]; dup {
+			problems = append(problems, fmt.Sprintf("%s shares a token with client %q", field, other))
+			continue
+		}
+		reg.tokens[h] = id
+	}
+
+	tenantIDs := map[string]bool{}
+	claimed := map[string]string{} // client|ODS -> tenant ID
+	for i := range f.Tenants {
+		t := f.Tenants[i]
+		field := fmt.Sprintf("tenants[%d]", i)
+		t.ID = strings.TrimSpace(t.ID)
+		switch {
+		case t.ID == "":
+			problems = append(problems, field+".id is required")
+		case tenantIDs[t.ID]:
+			problems = append(problems, fmt.Sprintf("%s.id %q is used more than once", field, t.ID))
+		}
+		tenantIDs[t.ID] = true
+		if strings.TrimSpace(t.MeshMailbox) == "" {
+			problems = append(problems, field+".meshMailbox is required")
+		}
+		if !asidPattern.MatchString(t.ASID) {
+			problems = append(problems, fmt.Sprintf("%s.asid %q must be 12 digits", field, t.ASID))
+		}
+		if s := t.IdentifierSystem; s != "" && !isSystemURL(s) {
+			problems = append(problems, fmt.Sprintf("%s.identifierSystem %q must be an absolute http(s) URL", field, s))
+		}
+		if len(t.ODSCodes) == 0 {
+			problems = append(problems, field+".odsCodes needs at least one code")
+		}
+		for j, code := range t.ODSCodes {
+			t.ODSCodes[j] = normaliseODS(code)
+		}
+		t.DefaultSenderODS = normaliseODS(t.DefaultSenderODS)
+		switch {
+		case t.DefaultSenderODS == "" && len(t.ODSCodes) == 1:
+			t.DefaultSenderODS = t.ODSCodes[0]
+		case t.DefaultSenderODS != "" && !contains(t.ODSCodes, t.DefaultSenderODS):
+			problems = append(problems, fmt.Sprintf("%s.defaultSenderODS %q is not one of its odsCodes", field, t.DefaultSenderODS))
+		}
+		if len(t.Clients) == 0 {
+			problems = append(problems, field+".clients needs at least one client")
+		}
+		for _, c := range t.Clients {
+			if _, ok := reg.byClient[c]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.clients: unknown client %q", field, c))
+				continue
+			}
+			for _, code := range t.ODSCodes {
+				key := c + "|" + code
+				if other, dup := claimed[key]; dup {
+					problems = append(problems, fmt.Sprintf("%s: client %q already sends as %s for tenant %q", field, c, code, other))
+				}
+				claimed[key] = t.ID
+			}
+			reg.byClient[c] = append(reg.byClient[c], &t)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return reg, nil
+}
+
+// Authenticate returns the client ID for a bearer token.
+func (r *Registry) Authenticate(token string) (string, bool) {
+	if r == nil || token == "" {
+		return "", false
+	}
+	id, ok := r.tokens[sha256.Sum256([]byte(token))]
+	return id, ok
+}
+
+// Resolve picks the tenant a client is sending for from the performer ODS
+// code. Without a code the client's only tenant is used.
+func (r *Registry) Resolve(clientID, performerODS string) (Tenant, error) {
+	tenants := r.byClient[clientID]
+	code := normaliseODS(performerODS)
+	if code == "" {
+		if len(tenants) == 1 {
+			return *tenants[0], nil
+		}
+		return Tenant{}, fmt.Errorf("%w: client %q sends for %d tenants, so performerODS is required", ErrNoTenant, clientID, len(tenants))
+	}
+	for _, t := range tenants {
+		if contains(t.ODSCodes, code) {
+			return *t, nil
+		}
+	}
+	return Tenant{}, fmt.Errorf("%w: client %q may not send as %s", ErrNoTenant, clientID, code)
+}
+
+// Len reports how many tenants are configured.
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	seen := map[*Tenant]bool{}
+	for _, ts := range r.byClient {
+		for _, t := range ts {
+			seen[t] = true
+		}
+	}
+	return len(seen)
+}
+
+func isSystemURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func normaliseODS(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}